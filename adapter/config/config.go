@@ -8,17 +8,39 @@ import (
 
 	"github.com/privatix/dapp-openvpn/adapter/mon"
 	"github.com/privatix/dapp-openvpn/adapter/msg"
+	"github.com/privatix/dapp-openvpn/adapter/secret"
+	"github.com/privatix/dapp-openvpn/adapter/sup"
 	"github.com/privatix/dapp-openvpn/adapter/tc"
 )
 
 type ovpnConfig struct {
-	Name         string        // Name of OvenVPN executable.
-	Args         []string      // Extra arguments for OpenVPN executable.
-	ConfigRoot   string        // Root path for OpenVPN channel configs.
-	StartDelay   time.Duration // Delay to ensure OpenVPN is ready, in milliseconds.
-	TapInterface string        // Windows TAP device name.
-	UpScript     string        // OpenVPN up script.
-	DownScript   string        // OpenVPN down script.
+	Name         string   // Name of OvenVPN executable.
+	Args         []string // Extra arguments for OpenVPN executable.
+	ConfigRoot   string   // Root path for OpenVPN channel configs.
+	TapInterface string   // Windows TAP device name.
+	UpScript     string   // OpenVPN up script.
+	DownScript   string   // OpenVPN down script.
+
+	// TapInterfaces are extra Windows TAP devices for concurrent
+	// connections, the first connection uses TapInterface.
+	TapInterfaces []string
+
+	// MaxConnections is a number of concurrent client connections. Only
+	// the include route policy allows more than one.
+	MaxConnections uint
+
+	// RoutePolicy is full, exclude-lan, include or exclude.
+	RoutePolicy   string
+	RouteNetworks []string // CIDRs for include and exclude policies.
+
+	// ConfigMaxAge is an age of channel configs wiped on start, in hours.
+	// Zero keeps them.
+	ConfigMaxAge uint
+
+	// TemplateDir overrides embedded client config templates with files
+	// of the same names, e.g. client-config.tpl.
+	TemplateDir     string
+	ExtraDirectives []string // Appended to client configs.
 }
 
 type sessConfig struct {
@@ -32,8 +54,12 @@ type natConfig struct {
 	*nat.Config
 }
 
+// Version is a version of the configuration schema.
+const Version = "2"
+
 // Config is dapp-openvpn adapter configuration.
 type Config struct {
+	Version         string
 	ChannelDir      string // Directory for common-name -> channel mappings.
 	ClientMode      bool
 	HeartbeatPeriod time.Duration // In milliseconds.
@@ -42,13 +68,16 @@ type Config struct {
 	NAT             *natConfig  // NAT settings for Agent mode.
 	OpenVPN         *ovpnConfig // OpenVPN settings for client mode.
 	Pusher          *msg.Config
+	Secrets         *secret.Config // Store of "secret:" values.
 	Sess            *sessConfig
+	Supervisor      *sup.Config // OpenVPN supervisor for client mode.
 	TC              *tc.Config
 }
 
 // NewConfig creates default dapp-openvpn configuration.
 func NewConfig() *Config {
 	return &Config{
+		Version:         Version,
 		ChannelDir:      ".",
 		ClientMode:      false,
 		HeartbeatPeriod: 2000,
@@ -56,14 +85,48 @@ func NewConfig() *Config {
 		Monitor:         mon.NewConfig(),
 		NAT:             &natConfig{Config: nat.NewConfig()},
 		OpenVPN: &ovpnConfig{
-			Name:       "openvpn",
-			ConfigRoot: "/etc/openvpn/config",
-			StartDelay: 1000,
+			Name:           "openvpn",
+			ConfigRoot:     "/etc/openvpn/config",
+			MaxConnections: 4,
+			RoutePolicy:    msg.RouteFull,
+			ConfigMaxAge:   24 * 7,
 		},
-		Pusher: msg.NewConfig(),
+		Pusher:  msg.NewConfig(),
+		Secrets: secret.NewConfig(),
 		Sess: &sessConfig{
 			Endpoint: "ws://localhost:8000/ws",
 		},
-		TC: tc.NewConfig(),
+		Supervisor: sup.NewConfig(),
+		TC:         tc.NewConfig(),
+	}
+}
+
+// redacted replaces secrets in a printed configuration.
+const redacted = "<redacted>"
+
+// Redacted returns a copy of the configuration without secrets.
+func (c *Config) Redacted() *Config {
+	result := *c
+	if c.Sess != nil && len(c.Sess.Password) != 0 {
+		sess := *c.Sess
+		sess.Password = redacted
+		result.Sess = &sess
+	}
+	return &result
+}
+
+// ResolveSecrets replaces secret references with their values. Relative
+// paths of the secret store are relative to a given directory.
+func (c *Config) ResolveSecrets(dir string) error {
+	if c.Sess == nil || !secret.IsRef(c.Sess.Password) {
+		return nil
+	}
+
+	store, err := secret.New(c.Secrets, dir)
+	if err != nil {
+		return err
 	}
+
+	c.Sess.Password, err = secret.Resolve(store, c.Sess.Password)
+	return err
 }
@@ -0,0 +1,178 @@
+// +build !noconfigtest
+
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/privatix/dapp-openvpn/adapter/secret"
+)
+
+const configV1 = `{
+    "ChannelDir": ".",
+    "Monitor": {"Addr": "localhost:7505", "ByteCountPeriod": 5},
+    "OpenVPN": {
+        "Name": "openvpn",
+        "ConfigRoot": "/etc/openvpn/config",
+        "StartDelay": 2000
+    },
+    "Pusher": {
+        "ExportConfigKeys": ["proto", "port", "ca"],
+        "TimeOut": 12
+    },
+    "Sess": {"Endpoint": "ws://localhost:8000/ws", "Password": "secret"}
+}`
+
+func TestMigrate(t *testing.T) {
+	conf, err := Parse([]byte(configV1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.Version != Version {
+		t.Fatalf("expected version %s, got %s", Version, conf.Version)
+	}
+
+	keys := strings.Join(conf.Pusher.ExportConfigKeys, ",")
+	if keys != "proto,port,ca,"+strings.Join(exportKeysV2, ",") {
+		t.Fatalf("unexpected export keys: %s", keys)
+	}
+}
+
+func TestBadConfig(t *testing.T) {
+	for data, field := range map[string]string{
+		`{"Version": "3"}`:                      "Version",
+		`{"Version": 2}`:                        "Version",
+		`{"Sess": {"Endpoint": ""}}`:            "Sess.Endpoint",
+		`{"Sess": {"Endpoint": "localhost"}}`:   "Sess.Endpoint",
+		`{"Monitor": {"Addr": "localhost"}}`:    "Monitor.Addr",
+		`{"OpenVPN": {"RoutePolicy": "all"}}`:   "OpenVPN.RoutePolicy",
+		`{"OpenVPN": {"RouteNetworks": ["1"]}}`: "OpenVPN.RouteNetworks",
+		`{"Pusher": {"TLSKeyMode": "none"}}`:    "Pusher.TLSKeyMode",
+		`{"Secrets": {"Store": "vault"}}`:       "Secrets.Store",
+	} {
+		_, err := Parse([]byte(data))
+		ferr, ok := err.(*FieldError)
+		if !ok {
+			t.Errorf("%s: expected field error, got %v", data, err)
+			continue
+		}
+		if ferr.Field != field {
+			t.Errorf("%s: expected field %s, got %s",
+				data, field, ferr.Field)
+		}
+	}
+}
+
+func TestExtraDirectives(t *testing.T) {
+	_, err := Parse([]byte(`{"OpenVPN": {"ExtraDirectives": ["mssfix 1400",
+		"sndbuf 393216"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Parse([]byte(`{"OpenVPN": {"ExtraDirectives": ["up x"]}}`))
+	if ferr, ok := err.(*FieldError); !ok ||
+		ferr.Field != "OpenVPN.ExtraDirectives" {
+		t.Fatalf("expected extra directives error, got %v", err)
+	}
+}
+
+func TestUnknownParams(t *testing.T) {
+	_, err := Parse([]byte(`{"Sess": {"Pasword": "secret"}}`))
+	if err == nil || !strings.Contains(err.Error(), "Pasword") {
+		t.Fatalf("expected unknown field error, got %v", err)
+	}
+
+	// Traffic control parameters differ between platforms.
+	_, err = Parse([]byte(`{"TC": {"Subnet": "10.0.0.0/24",
+		"Unknown": true}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPackagedConfigs(t *testing.T) {
+	for _, file := range []string{
+		"../../statik/package/config/adapter.config.json",
+		"../../files/example/dappvpn.agent.config.json",
+		"../../files/example/dappvpn.client.config.json",
+	} {
+		if _, err := Read(file); err != nil {
+			t.Errorf("%s: %v", file, err)
+		}
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	env := map[string]string{
+		"DAPPVPN_SESS_ENDPOINT": "ws://env:8000/ws",
+		"DAPPVPN_SESS_PASSWORD": "env-secret",
+		"DAPPVPN_LOG_LEVEL":     "debug",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := FlagOverrides(fs)
+	err := fs.Parse([]string{"-sess-endpoint", "ws://flag:8000/ws",
+		"-monitor-addr", "localhost:7506"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf, err := Parse([]byte(configV1), EnvOverrides(lookup), flags())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.Sess.Endpoint != "ws://flag:8000/ws" ||
+		conf.Sess.Password != "env-secret" ||
+		conf.FileLog.Level != "debug" ||
+		conf.Monitor.Addr != "localhost:7506" {
+		t.Fatalf("unexpected config: %+v, %+v", conf.Sess, conf.Monitor)
+	}
+
+	if conf.Redacted().Sess.Password != redacted ||
+		conf.Sess.Password != "env-secret" {
+		t.Fatal("password is not redacted")
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := NewConfig()
+	store, err := secret.New(conf.Secrets, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Set("sess", "stored-secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	conf.Sess.Password = secret.Ref("sess")
+	if err := conf.ResolveSecrets(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.Sess.Password != "stored-secret" {
+		t.Fatalf("unexpected password: %s", conf.Sess.Password)
+	}
+
+	conf.Sess.Password = secret.Ref("missing")
+	if err := conf.ResolveSecrets(dir); err != secret.ErrNotFound {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import "fmt"
+
+// migration upgrades a raw configuration from one version to the next.
+type migration struct {
+	from  string
+	to    string
+	apply func(map[string]interface{})
+}
+
+// migrations are ordered by version, the last one upgrades to Version.
+// Configurations without a version are of the first one.
+var migrations = []migration{
+	{"1", "2", migrateSupervisor},
+}
+
+// Migrate upgrades a raw configuration to the current version.
+func Migrate(raw map[string]interface{}) error {
+	version := migrations[0].from
+	if v, ok := raw["Version"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return &FieldError{Field: "Version",
+				Description: "must be a string"}
+		}
+		version = s
+	}
+
+	for _, m := range migrations {
+		if m.from == version {
+			m.apply(raw)
+			version = m.to
+		}
+	}
+
+	if version != Version {
+		return &FieldError{Field: "Version", Description: fmt.Sprintf(
+			"unsupported version %s, expected %s or older",
+			version, Version)}
+	}
+
+	raw["Version"] = version
+	return nil
+}
+
+// exportKeysV2 are OpenVPN options exported to clients since version 2.
+var exportKeysV2 = []string{"data-ciphers", "data-ciphers-fallback",
+	"ncp-ciphers", "allow-compression", "server"}
+
+// migrateSupervisor removes the OpenVPN start delay replaced by
+// the supervisor and exports options added to the server configuration.
+func migrateSupervisor(raw map[string]interface{}) {
+	if ovpn, ok := raw["OpenVPN"].(map[string]interface{}); ok {
+		delete(ovpn, "StartDelay")
+	}
+
+	pusher, ok := raw["Pusher"].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	keys, ok := pusher["ExportConfigKeys"].([]interface{})
+	if !ok {
+		return
+	}
+
+	exported := make(map[interface{}]bool)
+	for _, k := range keys {
+		exported[k] = true
+	}
+
+	for _, k := range exportKeysV2 {
+		if !exported[k] {
+			keys = append(keys, k)
+		}
+	}
+	pusher["ExportConfigKeys"] = keys
+}
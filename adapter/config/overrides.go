@@ -0,0 +1,92 @@
+package config
+
+import (
+	"flag"
+	"strings"
+)
+
+// EnvPrefix is a prefix of environment variables overriding configuration
+// parameters.
+const EnvPrefix = "DAPPVPN_"
+
+// Overrides are values of configuration parameters by their paths, e.g.
+// "Sess.Endpoint".
+type Overrides map[string]string
+
+// param is a configuration parameter, which can be overridden.
+type param struct {
+	path  string
+	flag  string
+	usage string
+	field func(*Config) *string
+}
+
+var params = []param{
+	{"Sess.Endpoint", "sess-endpoint", "Session server endpoint",
+		func(c *Config) *string { return &c.Sess.Endpoint }},
+	{"Sess.Origin", "sess-origin", "Session server origin",
+		func(c *Config) *string { return &c.Sess.Origin }},
+	{"Sess.Product", "sess-product", "Product ID",
+		func(c *Config) *string { return &c.Sess.Product }},
+	{"Sess.Password", "sess-password", "Product password",
+		func(c *Config) *string { return &c.Sess.Password }},
+	{"Monitor.Addr", "monitor-addr", "OpenVPN management interface",
+		func(c *Config) *string { return &c.Monitor.Addr }},
+	{"FileLog.Level", "log-level", "Log level",
+		func(c *Config) *string {
+			return (*string)(&c.FileLog.Level)
+		}},
+	{"FileLog.Filename", "log-file", "Log file name pattern",
+		func(c *Config) *string { return &c.FileLog.Filename }},
+	{"ChannelDir", "channel-dir", "Directory for channel mappings",
+		func(c *Config) *string { return &c.ChannelDir }},
+}
+
+// envName returns a name of an environment variable for a parameter, e.g.
+// DAPPVPN_SESS_ENDPOINT.
+func (p *param) envName() string {
+	return EnvPrefix +
+		strings.ToUpper(strings.Replace(p.flag, "-", "_", -1))
+}
+
+// EnvOverrides returns parameters set by environment variables.
+func EnvOverrides(lookup func(string) (string, bool)) Overrides {
+	result := make(Overrides)
+	for _, p := range params {
+		if v, ok := lookup(p.envName()); ok {
+			result[p.path] = v
+		}
+	}
+	return result
+}
+
+// FlagOverrides defines flags of parameters in the flag set. The returned
+// function gives parameters set by flags, it's called after parsing.
+func FlagOverrides(fs *flag.FlagSet) func() Overrides {
+	values := make(map[string]*string)
+	for _, p := range params {
+		values[p.flag] = fs.String(p.flag, "", p.usage+
+			", overrides "+p.path+" and "+p.envName())
+	}
+
+	return func() Overrides {
+		result := make(Overrides)
+		for _, p := range params {
+			name := p.flag
+			fs.Visit(func(f *flag.Flag) {
+				if f.Name == name {
+					result[p.path] = *values[name]
+				}
+			})
+		}
+		return result
+	}
+}
+
+func (o Overrides) apply(c *Config) {
+	for _, p := range params {
+		if v, ok := o[p.path]; ok {
+			*p.field(c) = v
+		}
+	}
+}
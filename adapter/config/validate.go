@@ -0,0 +1,177 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+
+	"github.com/privatix/dapp-openvpn/adapter/msg"
+	"github.com/privatix/dapp-openvpn/adapter/secret"
+)
+
+// FieldError is an error of a configuration parameter.
+type FieldError struct {
+	Field       string
+	Description string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("bad configuration parameter %s: %s",
+		e.Field, e.Description)
+}
+
+// Read reads, upgrades and validates a configuration file. Values of
+// the file are replaced with the overrides in order.
+func Read(file string, overrides ...Overrides) (*Config, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, overrides...)
+}
+
+// Parse upgrades and validates a configuration. Unknown parameters are
+// errors, except traffic control ones, which differ between platforms.
+// Values of the configuration are replaced with the overrides in order.
+func Parse(data []byte, overrides ...Overrides) (*Config, error) {
+	raw := make(map[string]interface{})
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid configuration json: %v", err)
+	}
+
+	if err := Migrate(raw); err != nil {
+		return nil, err
+	}
+
+	tc, hasTC := raw["TC"]
+	delete(raw, "TC")
+
+	conf := NewConfig()
+	if err := decode(raw, conf, true); err != nil {
+		return nil, err
+	}
+
+	if hasTC {
+		if err := decode(tc, conf.TC, false); err != nil {
+			return nil, &FieldError{Field: "TC",
+				Description: err.Error()}
+		}
+	}
+
+	for _, v := range overrides {
+		v.apply(conf)
+	}
+
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+func decode(raw interface{}, v interface{}, strict bool) error {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid configuration: %v", err)
+	}
+	return nil
+}
+
+// Validate checks values of the configuration.
+func (c *Config) Validate() error {
+	if len(c.ChannelDir) == 0 {
+		return &FieldError{Field: "ChannelDir", Description: "is empty"}
+	}
+
+	if c.HeartbeatPeriod <= 0 {
+		return &FieldError{Field: "HeartbeatPeriod",
+			Description: "must be positive"}
+	}
+
+	if c.Sess == nil || len(c.Sess.Endpoint) == 0 {
+		return &FieldError{Field: "Sess.Endpoint",
+			Description: "is empty"}
+	}
+
+	u, err := url.Parse(c.Sess.Endpoint)
+	if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") ||
+		len(u.Host) == 0 {
+		return &FieldError{Field: "Sess.Endpoint",
+			Description: "must be a ws:// or wss:// url"}
+	}
+
+	if c.Monitor == nil {
+		return &FieldError{Field: "Monitor", Description: "is not set"}
+	}
+
+	if _, _, err := net.SplitHostPort(c.Monitor.Addr); err != nil {
+		return &FieldError{Field: "Monitor.Addr",
+			Description: err.Error()}
+	}
+
+	if c.OpenVPN == nil || len(c.OpenVPN.Name) == 0 {
+		return &FieldError{Field: "OpenVPN.Name",
+			Description: "is empty"}
+	}
+
+	switch c.OpenVPN.RoutePolicy {
+	case "", msg.RouteFull, msg.RouteExcludeLAN, msg.RouteInclude,
+		msg.RouteExclude:
+	default:
+		return &FieldError{Field: "OpenVPN.RoutePolicy",
+			Description: "unknown policy " + c.OpenVPN.RoutePolicy}
+	}
+
+	for _, v := range c.OpenVPN.RouteNetworks {
+		if _, _, err := net.ParseCIDR(v); err != nil {
+			return &FieldError{Field: "OpenVPN.RouteNetworks",
+				Description: err.Error()}
+		}
+	}
+
+	for _, v := range c.OpenVPN.ExtraDirectives {
+		if err := msg.CheckDirective(v); err != nil {
+			return &FieldError{Field: "OpenVPN.ExtraDirectives",
+				Description: err.Error() + ": " + v}
+		}
+	}
+
+	if c.ClientMode && c.OpenVPN.MaxConnections == 0 {
+		return &FieldError{Field: "OpenVPN.MaxConnections",
+			Description: "must be positive"}
+	}
+
+	if c.Pusher == nil {
+		return &FieldError{Field: "Pusher", Description: "is not set"}
+	}
+
+	switch c.Pusher.TLSKeyMode {
+	case "", msg.TLSAuth, msg.TLSCrypt:
+	default:
+		return &FieldError{Field: "Pusher.TLSKeyMode",
+			Description: "unknown mode " + c.Pusher.TLSKeyMode}
+	}
+
+	if c.Secrets == nil {
+		return &FieldError{Field: "Secrets", Description: "is not set"}
+	}
+
+	switch c.Secrets.Store {
+	case secret.StoreFile, secret.StoreEncrypted, secret.StoreKeyring:
+	default:
+		return &FieldError{Field: "Secrets.Store",
+			Description: "unknown store " + c.Secrets.Store}
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/privatix/dapp-openvpn/adapter/config"
+	"github.com/privatix/dapp-openvpn/adapter/mon"
+	"github.com/privatix/dapp-openvpn/adapter/msg"
+	"github.com/privatix/dapp-openvpn/adapter/prepare"
+	"github.com/privatix/dapp-openvpn/adapter/sup"
+)
+
+// connection is a running client connection. Each connection uses a slot,
+// which defines its management port and Windows TAP device.
+type connection struct {
+	slot   int
+	cancel context.CancelFunc
+	done   chan struct{}
+	closed bool // Channel is closed, so its files are wiped on exit.
+}
+
+// connManager runs client connections of several channels at once.
+type connManager struct {
+	mtx         sync.Mutex
+	conns       map[string]*connection
+	slots       []bool // Slots in use.
+	getEndpoint prepare.GetEndpointFunc
+}
+
+func newConnManager(getEndpoint prepare.GetEndpointFunc) *connManager {
+	slots := int(conf.OpenVPN.MaxConnections)
+	if msg.RedirectsGateway(conf.OpenVPN.RoutePolicy) && slots > 1 {
+		// Tunnels would fight over the default route.
+		logger.Add("method", "newConnManager").Warn(fmt.Sprintf(
+			"%s route policy allows a single connection",
+			conf.OpenVPN.RoutePolicy))
+		slots = 1
+	}
+	if len(conf.OpenVPN.TapInterface) != 0 {
+		// Each connection needs its own TAP device.
+		taps := 1 + len(conf.OpenVPN.TapInterfaces)
+		if slots == 0 || taps < slots {
+			slots = taps
+		}
+	}
+
+	return &connManager{
+		conns:       make(map[string]*connection),
+		slots:       make([]bool, slots),
+		getEndpoint: getEndpoint,
+	}
+}
+
+// channelConfig returns adapter configuration for a given slot.
+func channelConfig(slot int) *config.Config {
+	logger := logger.Add("method", "channelConfig", "slot", slot)
+
+	host, port, err := net.SplitHostPort(conf.Monitor.Addr)
+	if err != nil {
+		logger.Fatal("bad monitor address: " + err.Error())
+	}
+
+	basePort, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || basePort+uint64(slot) > 0xFFFF {
+		logger.Fatal("bad monitor port: " + port)
+	}
+
+	monitor := *conf.Monitor
+	monitor.Addr = net.JoinHostPort(host,
+		strconv.FormatUint(basePort+uint64(slot), 10))
+
+	ovpn := *conf.OpenVPN
+	if slot > 0 && len(ovpn.TapInterface) != 0 {
+		ovpn.TapInterface = ovpn.TapInterfaces[slot-1]
+	}
+
+	cconf := *conf
+	cconf.Monitor = &monitor
+	cconf.OpenVPN = &ovpn
+	return &cconf
+}
+
+func (m *connManager) freeSlot() int {
+	for i, used := range m.slots {
+		if !used {
+			return i
+		}
+	}
+	return -1
+}
+
+// start reserves a slot for a channel and launches OpenVPN for it. The
+// client configuration is prepared in the background, so that other
+// channels are not delayed.
+func (m *connManager) start(channel string) {
+	logger := logger.Add("method", "start", "channel", channel)
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if _, ok := m.conns[channel]; ok {
+		logger.Warn("requested to start while " +
+			"OpenVPN is still running")
+		return
+	}
+
+	slot := m.freeSlot()
+	if slot < 0 {
+		logger.Warn(fmt.Sprintf("requested to start while "+
+			"%d connections are running", len(m.slots)))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	conn := &connection{
+		slot:   slot,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	m.slots[slot] = true
+	m.conns[channel] = conn
+
+	go m.launch(ctx, channel, conn)
+}
+
+// launch prepares a client configuration for a channel and runs OpenVPN
+// for it in a reserved slot.
+func (m *connManager) launch(ctx context.Context, channel string,
+	conn *connection) {
+	logger := logger.Add("method", "launch", "channel", channel)
+
+	cconf := channelConfig(conn.slot)
+
+	creds, err := prepare.ClientConfig(logger, channel, cconf,
+		m.getEndpoint)
+	if err != nil {
+		logger.Error("failed to prepare client config: " +
+			err.Error())
+		m.release(channel, conn)
+		close(conn.done)
+		return
+	}
+
+	if ctx.Err() != nil {
+		// Stopped while the configuration was prepared.
+		m.release(channel, conn)
+		close(conn.done)
+		return
+	}
+
+	m.mtx.Lock()
+	storeActiveChannel(channel)
+	m.mtx.Unlock()
+
+	m.run(ctx, channel, cconf, creds, conn)
+}
+
+// release frees a slot of a finished connection.
+func (m *connManager) release(channel string, conn *connection) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	delete(m.conns, channel)
+	m.slots[conn.slot] = false
+	removeActiveChannel(channel)
+
+	if conn.closed {
+		wipeChannelDir(channel)
+	}
+}
+
+// stop stops OpenVPN of a closed channel and wipes its files.
+func (m *connManager) stop(channel string) {
+	m.mtx.Lock()
+	conn, ok := m.conns[channel]
+	if ok {
+		conn.closed = true
+	}
+	m.mtx.Unlock()
+
+	if !ok {
+		logger.Add("method", "stop", "channel", channel).Warn(
+			"requested to stop while OpenVPN is not running")
+		sessionHandler{}.StopSession(channel)
+		wipeChannelDir(channel)
+		return
+	}
+
+	conn.cancel()
+}
+
+// stopAll stops all running connections and waits for them to finish.
+func (m *connManager) stopAll() {
+	m.mtx.Lock()
+	var conns []*connection
+	for _, conn := range m.conns {
+		conn.cancel()
+		conns = append(conns, conn)
+	}
+	m.mtx.Unlock()
+
+	for _, conn := range conns {
+		<-conn.done
+	}
+}
+
+func (m *connManager) run(ctx context.Context, channel string,
+	cconf *config.Config, creds *msg.Credentials, conn *connection) {
+	logger := logger.Add("channel", channel)
+
+	defer close(conn.done)
+
+	if len(cconf.OpenVPN.Name) == 0 {
+		logger.Fatal("no OpenVPN command provided")
+	}
+
+	args := append([]string{}, cconf.OpenVPN.Args...)
+	args = append(args, "--config", filepath.Join(
+		cconf.OpenVPN.ConfigRoot, channel, "client.ovpn"))
+
+	var logFile string
+	if len(cconf.FileLog.Filename) != 0 {
+		logFile = msg.LogFile(
+			filepath.Dir(cconf.FileLog.Filename), channel)
+	}
+
+	supervisor := sup.NewSupervisor(cconf.Supervisor,
+		logger, cconf.OpenVPN.Name, args, logFile)
+
+	// Monitor is started every time OpenVPN is (re)started. OpenVPN exits
+	// when the monitor disconnects from it.
+	ready := func(ctx context.Context) {
+		monitor := mon.NewMonitor(cconf.Monitor, logger,
+			&sessionHandler{}, channel)
+		monitor.SetAuth(creds.Username, creds.Password)
+		err := monitor.MonitorTraffic(ctx)
+		logger.Warn("failed to monitor vpn traffic: " + err.Error())
+	}
+
+	if err := supervisor.Run(ctx, ready); err != nil {
+		logger.Warn(fmt.Sprintf("OpenVPN exited: %v", err))
+	}
+	sessionHandler{}.StopSession(channel)
+	m.release(channel, conn)
+}
+
+// wipeChannelDir wipes client configuration files of a channel.
+func wipeChannelDir(channel string) {
+	dir := filepath.Join(conf.OpenVPN.ConfigRoot, channel)
+	if err := msg.WipeDir(dir); err != nil {
+		logger.Add("method", "wipeChannelDir", "channel", channel).Warn(
+			"failed to wipe client configuration: " + err.Error())
+	}
+}
@@ -1,7 +1,49 @@
 package data
 
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Priority classes of an offering.
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
 // OfferingParams is an offering additional parameters for VPN.
 type OfferingParams struct {
+	// MinUploadMbits and MinDownloadMbits are guaranteed rates.
 	MinUploadMbits   float32 `json:"minUploadMbits"`
 	MinDownloadMbits float32 `json:"minDownloadMbits"`
+
+	// MaxUploadMbits and MaxDownloadMbits are ceilings up to which idle
+	// bandwidth can be borrowed, the whole uplink when zero.
+	MaxUploadMbits   float32 `json:"maxUploadMbits,omitempty"`
+	MaxDownloadMbits float32 `json:"maxDownloadMbits,omitempty"`
+
+	// BurstKbytes is an amount of data which can be sent at the link
+	// speed, before the rate limit is applied.
+	BurstKbytes uint32 `json:"burstKbytes,omitempty"`
+
+	// Priority is a priority class for borrowing idle bandwidth:
+	// high, normal or low. Normal when empty.
+	Priority string `json:"priority,omitempty"`
+}
+
+// Merge validates given params and merges them into the current ones, e.g.
+// {"maxDownloadMbits": 1} changes a download ceiling only.
+func (p *OfferingParams) Merge(data []byte) error {
+	if err := ValidateParams(data); err != nil {
+		return err
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(p)
 }
@@ -0,0 +1,97 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// ParamsVersion is a version of additional params this adapter produces.
+const ParamsVersion = "1"
+
+// Params are additional params of a VPN offering and its endpoint. Rates
+// are set by an agent in an offering, connection params are pushed from
+// the agent's server configuration.
+type Params struct {
+	Version string `json:"version,omitempty"`
+
+	OfferingParams
+
+	Proto               string  `json:"proto,omitempty"`
+	Port                string  `json:"port,omitempty"`
+	Server              string  `json:"server,omitempty"`
+	ExternalIP          string  `json:"externalIP,omitempty"`
+	Cipher              string  `json:"cipher,omitempty"`
+	DataCiphers         string  `json:"data-ciphers,omitempty"`
+	DataCiphersFallback string  `json:"data-ciphers-fallback,omitempty"`
+	NCPCiphers          string  `json:"ncp-ciphers,omitempty"`
+	AllowCompression    string  `json:"allow-compression,omitempty"`
+	CompLZO             *string `json:"comp-lzo,omitempty"`
+	Ping                string  `json:"ping,omitempty"`
+	PingRestart         string  `json:"ping-restart,omitempty"`
+	ConnectRetry        string  `json:"connect-retry,omitempty"`
+	DNS                 string  `json:"dns,omitempty"`
+	Ca                  string  `json:"caData,omitempty"`
+	TLSKey              string  `json:"tlsKeyData,omitempty"`
+	TLSKeyMode          string  `json:"tlsKeyMode,omitempty"`
+}
+
+// ParamError is an error of an additional param, which does not match
+// the schema.
+type ParamError struct {
+	Field       string
+	Description string
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("bad additional param %s: %s",
+		e.Field, e.Description)
+}
+
+var paramsSchema = gojsonschema.NewStringLoader(ParamsSchema)
+
+// ValidateParams validates additional params against the schema. Empty
+// params are valid.
+func ValidateParams(data []byte) error {
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil
+	}
+
+	result, err := gojsonschema.Validate(paramsSchema,
+		gojsonschema.NewBytesLoader(data))
+	if err != nil {
+		return &ParamError{Field: "(root)", Description: err.Error()}
+	}
+
+	if errs := result.Errors(); len(errs) != 0 {
+		return &ParamError{
+			Field:       errs[0].Field(),
+			Description: errs[0].Description(),
+		}
+	}
+	return nil
+}
+
+// DecodeParams validates and decodes additional params.
+func DecodeParams(data []byte) (*Params, error) {
+	var params Params
+	if err := ValidateParams(data); err != nil {
+		return nil, err
+	}
+
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return &params, nil
+	}
+
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+	return &params, nil
+}
+
+// DNSServers returns DNS servers pushed by an agent.
+func (p *Params) DNSServers() []string {
+	return strings.Fields(p.DNS)
+}
@@ -0,0 +1,77 @@
+// +build !nodatatest
+
+package data
+
+import "testing"
+
+func TestDecodeParams(t *testing.T) {
+	params, err := DecodeParams([]byte(`{"version": "1",
+		"minDownloadMbits": 2.5, "priority": "high", "proto": "udp",
+		"port": "443", "comp-lzo": "", "dns": "1.1.1.1 9.9.9.9",
+		"keepalive": "10 120"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if params.MinDownloadMbits != 2.5 || params.Priority != PriorityHigh ||
+		params.Port != "443" || params.CompLZO == nil ||
+		len(params.DNSServers()) != 2 {
+		t.Fatalf("unexpected params: %+v", params)
+	}
+
+	params, err = DecodeParams(nil)
+	if err != nil || params.CompLZO != nil {
+		t.Fatalf("unexpected empty params: %+v, %v", params, err)
+	}
+}
+
+func TestBadParams(t *testing.T) {
+	for data, field := range map[string]string{
+		`{"minUploadMbits": "2"}`:    "minUploadMbits",
+		`{"minDownloadMbits": -1}`:   "minDownloadMbits",
+		`{"burstKbytes": 1.5}`:       "burstKbytes",
+		`{"priority": "urgent"}`:     "priority",
+		`{"port": 443}`:              "port",
+		`{"port": "65536"}`:          "port",
+		`{"proto": "sctp"}`:          "proto",
+		`{"cipher": "AES 256"}`:      "cipher",
+		`{"ping": "10s"}`:            "ping",
+		`{"dns": "1.1.1.1,8.8.8.8"}`: "dns",
+		`{"version": "2"}`:           "version",
+		`{"tlsKeyMode": "none"}`:     "tlsKeyMode",
+	} {
+		_, err := DecodeParams([]byte(data))
+		perr, ok := err.(*ParamError)
+		if !ok {
+			t.Errorf("%s: expected param error, got %v", data, err)
+			continue
+		}
+		if perr.Field != field {
+			t.Errorf("%s: expected field %s, got %s",
+				data, field, perr.Field)
+		}
+	}
+}
+
+func TestMergeOfferingParams(t *testing.T) {
+	params := OfferingParams{MinDownloadMbits: 10, MinUploadMbits: 2,
+		Priority: PriorityHigh}
+
+	merged := `{"maxDownloadMbits": 1, "priority": "low"}`
+	if err := params.Merge([]byte(merged)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := OfferingParams{MinDownloadMbits: 10, MinUploadMbits: 2,
+		MaxDownloadMbits: 1, Priority: PriorityLow}
+	if params != expected {
+		t.Fatalf("unexpected merged params: %+v", params)
+	}
+
+	for _, data := range []string{`{"maxDownloadMbits": -1}`,
+		`{"proto": "udp"}`} {
+		if err := params.Merge([]byte(data)); err == nil {
+			t.Errorf("%s: merged bad params", data)
+		}
+	}
+}
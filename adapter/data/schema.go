@@ -0,0 +1,64 @@
+package data
+
+// ParamsSchema is a JSON schema of additional params. Connection params
+// are strings, since an endpoint keeps them as a string map.
+const ParamsSchema = `{
+    "title": "Privatix VPN additional params",
+    "type": "object",
+    "definitions": {
+        "mbits": {"type": "number", "minimum": 0},
+        "seconds": {"type": "string", "pattern": "^[0-9]+$"},
+        "ciphers": {
+            "type": "string",
+            "pattern": "^[A-Za-z0-9-]+(:[A-Za-z0-9-]+)*$"
+        }
+    },
+    "properties": {
+        "version": {"type": "string", "enum": ["1"]},
+        "minUploadMbits": {"$ref": "#/definitions/mbits"},
+        "minDownloadMbits": {"$ref": "#/definitions/mbits"},
+        "maxUploadMbits": {"$ref": "#/definitions/mbits"},
+        "maxDownloadMbits": {"$ref": "#/definitions/mbits"},
+        "burstKbytes": {
+            "type": "integer",
+            "minimum": 0,
+            "maximum": 4294967295
+        },
+        "priority": {"type": "string", "enum": ["high", "normal", "low"]},
+        "proto": {
+            "type": "string",
+            "pattern": "^(udp|tcp)[46]?(-server|-client)?$"
+        },
+        "port": {
+            "type": "string",
+            "pattern": "^([1-9][0-9]{0,3}|[1-5][0-9]{4}|6[0-4][0-9]{3}|65[0-4][0-9]{2}|655[0-2][0-9]|6553[0-5])$"
+        },
+        "server": {
+            "type": "string",
+            "pattern": "^([0-9]{1,3}\\.){3}[0-9]{1,3} ([0-9]{1,3}\\.){3}[0-9]{1,3}$"
+        },
+        "externalIP": {"type": "string"},
+        "cipher": {"$ref": "#/definitions/ciphers"},
+        "data-ciphers": {"$ref": "#/definitions/ciphers"},
+        "data-ciphers-fallback": {"$ref": "#/definitions/ciphers"},
+        "ncp-ciphers": {"$ref": "#/definitions/ciphers"},
+        "allow-compression": {"type": "string", "enum": ["no", "asym", "yes"]},
+        "comp-lzo": {"type": "string"},
+        "ping": {"$ref": "#/definitions/seconds"},
+        "ping-restart": {"$ref": "#/definitions/seconds"},
+        "connect-retry": {
+            "type": "string",
+            "pattern": "^[0-9]+( [0-9]+)?$"
+        },
+        "dns": {
+            "type": "string",
+            "pattern": "^([0-9]{1,3}\\.){3}[0-9]{1,3}( ([0-9]{1,3}\\.){3}[0-9]{1,3})*$"
+        },
+        "caData": {"type": "string"},
+        "tlsKeyData": {"type": "string"},
+        "tlsKeyMode": {
+            "type": "string",
+            "enum": ["", "tls-auth", "tls-crypt"]
+        }
+    }
+}`
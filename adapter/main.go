@@ -1,24 +1,20 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/privatix/dappctrl/data"
 	"github.com/privatix/dappctrl/nat"
 	"github.com/privatix/dappctrl/sess"
-	"github.com/privatix/dappctrl/util"
 	"github.com/privatix/dappctrl/util/log"
 	"github.com/privatix/dappctrl/version"
 
@@ -26,7 +22,6 @@ import (
 	vpndata "github.com/privatix/dapp-openvpn/adapter/data"
 	"github.com/privatix/dapp-openvpn/adapter/mon"
 	"github.com/privatix/dapp-openvpn/adapter/msg"
-	"github.com/privatix/dapp-openvpn/adapter/prepare"
 	"github.com/privatix/dapp-openvpn/adapter/tc"
 )
 
@@ -66,17 +61,37 @@ func main() {
 
 	fconfig := flag.String(
 		"config", "adapter.config.json", "Configuration file")
+	rateCh := flag.String("ratelimit", "",
+		"Change a rate limit of a connected client of a given channel")
+	rateParams := flag.String("ratelimit-params", "{}",
+		"Offering params in json to change a rate limit with")
+	checkConfig := flag.Bool("check-config", false,
+		"Validate the configuration file and exit")
+	printConfig := flag.Bool("print-config", false,
+		"Print the effective configuration without secrets and exit")
+	flagOverrides := config.FlagOverrides(flag.CommandLine)
 	flag.Parse()
 
 	version.Print(*v, Commit, Version)
 
-	conf = config.NewConfig()
-	if err := util.ReadJSONFile(*fconfig, &conf); err != nil {
+	var err error
+	conf, err = config.Read(*fconfig,
+		config.EnvOverrides(os.LookupEnv), flagOverrides())
+	if err == nil {
+		err = conf.ResolveSecrets(filepath.Dir(*fconfig))
+	}
+	if *checkConfig {
+		handleCheckConfig(*fconfig, err)
+		return
+	}
+	if *printConfig {
+		handlePrintConfig(*fconfig, err)
+		return
+	}
+	if err != nil {
 		panic(fmt.Sprintf("failed to read configuration: %s\n", err))
 	}
 
-	var err error
-
 	var closer io.Closer
 	logger, closer, err = createLogger()
 	if err != nil {
@@ -84,14 +99,19 @@ func main() {
 	}
 	defer closer.Close()
 
+	tctrl = tc.NewTrafficControl(conf.TC, logger)
+
+	if len(*rateCh) != 0 {
+		handleRateLimit(*rateCh, *rateParams)
+		return
+	}
+
 	sesscl, err = sess.Dial(context.Background(), conf.Sess.Endpoint,
 		conf.Sess.Origin, conf.Sess.Product, conf.Sess.Password)
 	if err != nil {
 		panic("failed to connect to session server: " + err.Error())
 	}
 
-	tctrl = tc.NewTrafficControl(conf.TC, logger)
-
 	switch os.Getenv("script_type") {
 	case "user-pass-verify":
 		handleAuth()
@@ -104,6 +124,29 @@ func main() {
 	}
 }
 
+func handleCheckConfig(file string, err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s: configuration version %s is valid\n",
+		file, conf.Version)
+}
+
+func handlePrintConfig(file string, err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+		os.Exit(1)
+	}
+
+	data, err := json.MarshalIndent(conf.Redacted(), "", "    ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(string(data))
+}
+
 func handleAuth() {
 	logger := logger.Add("method", "handleAuth")
 	user, pass := getCreds()
@@ -126,26 +169,45 @@ func handleConnect() {
 		logger.Fatal("bad trusted_port value")
 	}
 
+	ch := loadChannel()
+
 	var offer *data.Offering
-	offer, err = sesscl.StartSession(os.Getenv("trusted_ip"), loadChannel(), uint16(port))
+	offer, err = sesscl.StartSession(os.Getenv("trusted_ip"), ch, uint16(port))
 	if err != nil {
 		logger.Fatal("failed to start session: " + err.Error())
 	}
 
-	if len(channel) != 0 || offer.AdditionalParams == nil {
+	if len(channel) != 0 {
 		return
 	}
 
-	var params vpndata.OfferingParams
-	err = json.Unmarshal(offer.AdditionalParams, &params)
+	// The rate limit is kept even without offering params, so that
+	// the client can be throttled later.
+	limit := &rateLimit{
+		Iface:    os.Getenv("dev"),
+		ClientIP: os.Getenv("ifconfig_pool_remote_ip"),
+	}
+	if offer.AdditionalParams != nil {
+		params, err := vpndata.DecodeParams(offer.AdditionalParams)
+		if err != nil {
+			logger.Add("offering_params", offer.AdditionalParams).Fatal(
+				"failed to decode offering params: " + err.Error())
+		}
+		limit.Params = params.OfferingParams
+	}
+	storeRateLimit(ch, limit)
+
+	if offer.AdditionalParams == nil {
+		return
+	}
+
+	up, down, err := tc.Profiles(&limit.Params)
 	if err != nil {
 		logger.Add("offering_params", offer.AdditionalParams).Fatal(
-			"failed to unmarshal offering params: " + err.Error())
+			"bad offering params: " + err.Error())
 	}
 
-	err = tctrl.SetRateLimit(os.Getenv("dev"),
-		os.Getenv("ifconfig_pool_remote_ip"),
-		params.MinUploadMbits, params.MinDownloadMbits)
+	err = tctrl.SetRateLimit(limit.Iface, limit.ClientIP, up, down)
 	if err != nil {
 		logger.Fatal("failed to set rate limit: " + err.Error())
 	}
@@ -164,11 +226,15 @@ func handleDisconnect() {
 		panic("bad bytes_received value")
 	}
 
-	err = sesscl.StopSession(loadChannel())
+	ch := loadChannel()
+
+	err = sesscl.StopSession(ch)
 	if err != nil {
 		logger.Fatal("failed to stop session: " + err.Error())
 	}
 
+	removeRateLimit(ch)
+
 	err = tctrl.UnsetRateLimit(os.Getenv("dev"),
 		os.Getenv("ifconfig_pool_remote_ip"))
 	if err != nil {
@@ -276,18 +342,51 @@ func handlePusher(ctx context.Context, dir string) {
 
 	go openExtPort(ctx, network, netPort)
 
-	if msg.IsDone(dir) {
+	pushConfiguration(ctx, logger, pusher, dir, params)
+	pusher.CheckCertificates()
+
+	// Certificates and keys may be renewed by the installer, so
+	// the configuration is checked for changes and pushed again.
+	if conf.Pusher.WatchInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(
+		time.Duration(conf.Pusher.WatchInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pusher.CheckCertificates()
+
+		params, err := pusher.VpnParams()
+		if err != nil {
+			continue
+		}
+		pushConfiguration(ctx, logger, pusher, dir, params)
+	}
+}
+
+func pushConfiguration(ctx context.Context, logger log.Logger,
+	pusher *msg.Pusher, dir string, params map[string]string) {
+	hash := pusher.Hash(params)
+	if msg.IsDone(dir, hash) {
 		return
 	}
 
-	err = pusher.PushConfiguration(ctx, params)
+	err := pusher.PushConfiguration(ctx, params)
 	if err != nil {
 		logger.Error("failed to push app config to" +
 			" dappctrl")
 		return
 	}
 
-	err = msg.Done(dir)
+	err = msg.Done(dir, hash)
 	if err == nil {
 		return
 	}
@@ -327,16 +426,16 @@ func handleAgentMonitor(confFile string) {
 	logger.Fatal(<-fatal)
 }
 
-var (
-	mtx     sync.Mutex
-	ovpnCmd *exec.Cmd
-)
-
 func handleClientMonitor() {
-	if channel := loadActiveChannel(); len(channel) != 0 {
+	for _, channel := range loadActiveChannels() {
 		logger.Warn("interrupted connection detected: " + channel)
 		sessionHandler{}.StopSession(channel)
-		removeActiveChannel()
+		removeActiveChannel(channel)
+	}
+
+	if conf.OpenVPN.ConfigMaxAge != 0 {
+		msg.CleanClientDirs(logger, conf.OpenVPN.ConfigRoot,
+			time.Duration(conf.OpenVPN.ConfigMaxAge)*time.Hour)
 	}
 
 	getEndpoint := func(clientKey string) (*data.Endpoint, error) {
@@ -344,38 +443,10 @@ func handleClientMonitor() {
 		return ept, err
 	}
 
-	stopOvpnAndMonitor := func() {}
-	defer stopOvpnAndMonitor()
-
-	onConnStart := func(channel string) {
-		if ovpnCmd != nil {
-			logger.Warn("requested to start while " +
-				"OpenVPN is still running")
-			return
-		}
-
-		err := prepare.ClientConfig(logger, channel, conf, getEndpoint)
-		if err != nil {
-			message := "failed to prepare client config: "
-			logger.Fatal(message + err.Error())
-		}
-
-		ctx, cancel := context.WithCancel(context.Background())
-		stopOvpnAndMonitor = cancel
-		ovpnCmd = launchOpenVPN(ctx, channel)
-	}
-
-	onConnStop := func(channel string) {
-		if ovpnCmd == nil {
-			logger.Warn("requested to stop while OpenVPN is not running")
-			sessionHandler{}.StopSession(channel)
-			return
-		}
+	manager := newConnManager(getEndpoint)
+	defer manager.stopAll()
 
-		stopOvpnAndMonitor()
-	}
-
-	subscribeAndStartHandlingConnChanges(onConnStart, onConnStop)
+	subscribeAndStartHandlingConnChanges(manager.start, manager.stop)
 }
 
 func subscribeAndStartHandlingConnChanges(onStart, onStop func(string)) {
@@ -396,76 +467,13 @@ func subscribeAndStartHandlingConnChanges(onStart, onStop func(string)) {
 	for res := range ch {
 		logger.Info(fmt.Sprintf("connection change: %v", res))
 
-		mtx.Lock()
 		switch res.Status {
 		case sess.ConnStart:
 			onStart(res.Channel)
 		case sess.ConnStop:
 			onStop(res.Channel)
 		}
-		mtx.Unlock()
 	}
 
 	logger.Fatal("unexpected end of subscription to connection changes")
 }
-
-func launchOpenVPN(ctx context.Context, channel string) *exec.Cmd {
-	if len(conf.OpenVPN.Name) == 0 {
-		logger.Fatal("no OpenVPN command provided")
-	}
-
-	args := append(conf.OpenVPN.Args, "--config")
-	args = append(args, filepath.Join(
-		conf.OpenVPN.ConfigRoot, channel, "client.ovpn"))
-
-	cmd := exec.Command(conf.OpenVPN.Name, args...)
-
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		logger.Fatal("failed to access OpenVPN stdout: " + err.Error())
-	}
-
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		logger.Fatal("failed to access OpenVPN stderr: " + err.Error())
-	}
-
-	if err := cmd.Start(); err != nil {
-		logger.Fatal("failed to launch OpenVPN: " + err.Error())
-	}
-
-	storeActiveChannel(channel)
-
-	go func() {
-		scanner := bufio.NewScanner(io.MultiReader(stdout, stderr))
-		for scanner.Scan() {
-			line := "openvpn: " + scanner.Text() + "\n"
-			io.WriteString(os.Stderr, line)
-		}
-		if err := scanner.Err(); err != nil {
-			message := "failed to read from openVPN stdout/stderr: "
-			logger.Warn(message + err.Error())
-		}
-		stdout.Close()
-		stderr.Close()
-	}()
-
-	go func() {
-		logger.Warn(fmt.Sprintf("OpenVPN exited: %v", cmd.Wait()))
-		sessionHandler{}.StopSession(channel)
-		removeActiveChannel()
-		mtx.Lock()
-		ovpnCmd = nil
-		mtx.Unlock()
-	}()
-
-	time.Sleep(conf.OpenVPN.StartDelay * time.Millisecond)
-
-	monitor := mon.NewMonitor(conf.Monitor, logger, &sessionHandler{}, channel)
-	go func() {
-		err := monitor.MonitorTraffic(ctx)
-		logger.Warn("failed to monitor vpn traffic: " + err.Error())
-	}()
-
-	return cmd
-}
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 const (
@@ -88,40 +89,70 @@ func getCreds() (string, string) {
 	return user, pass
 }
 
-func storeActiveChannel(ch string) {
-	name := filepath.Join(conf.ChannelDir, "active")
-
-	logger := logger.Add("method", "storeActiveChannel",
-		"file", name, "channel", ch)
-
-	err := ioutil.WriteFile(name, []byte(ch), chanPerm)
-	if err != nil {
-		logger.Fatal("failed to store active channel: " + err.Error())
-	}
+// activeChannelsFile returns a file with channels of running client connections,
+// one per line.
+func activeChannelsFile() string {
+	return filepath.Join(conf.ChannelDir, "active")
 }
 
-func loadActiveChannel() string {
-	name := filepath.Join(conf.ChannelDir, "active")
+func loadActiveChannels() []string {
+	name := activeChannelsFile()
 
-	logger := logger.Add("method", "loadActiveChannel", "file", name)
+	logger := logger.Add("method", "loadActiveChannels", "file", name)
 
 	data, err := ioutil.ReadFile(name)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return ""
+			return nil
 		}
-		logger.Fatal("failed to load active channel: " + err.Error())
+		logger.Fatal("failed to load active channels: " + err.Error())
 	}
 
-	return string(data)
+	var channels []string
+	for _, ch := range strings.Split(string(data), "\n") {
+		if ch = strings.TrimSpace(ch); len(ch) != 0 {
+			channels = append(channels, ch)
+		}
+	}
+	return channels
 }
 
-func removeActiveChannel() {
-	name := filepath.Join(conf.ChannelDir, "active")
+func saveActiveChannels(channels []string) {
+	name := activeChannelsFile()
 
-	logger := logger.Add("method", "removeActiveChannel", "file", name)
+	logger := logger.Add("method", "saveActiveChannels", "file", name)
 
-	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
-		logger.Fatal("failed to remove active channel: " + err.Error())
+	if len(channels) == 0 {
+		err := os.Remove(name)
+		if err != nil && !os.IsNotExist(err) {
+			logger.Fatal("failed to remove active channels: " +
+				err.Error())
+		}
+		return
+	}
+
+	data := []byte(strings.Join(channels, "\n") + "\n")
+	if err := ioutil.WriteFile(name, data, chanPerm); err != nil {
+		logger.Fatal("failed to store active channels: " + err.Error())
+	}
+}
+
+func storeActiveChannel(ch string) {
+	channels := loadActiveChannels()
+	for _, v := range channels {
+		if v == ch {
+			return
+		}
+	}
+	saveActiveChannels(append(channels, ch))
+}
+
+func removeActiveChannel(ch string) {
+	var channels []string
+	for _, v := range loadActiveChannels() {
+		if v != ch {
+			channels = append(channels, v)
+		}
 	}
+	saveActiveChannels(channels)
 }
@@ -8,12 +8,14 @@ const (
 	ErrServerOutdated errors.Error = 0xABB7 + iota
 	ErrMonitoringCancelled
 	ErrCmdReceiveTimeout
+	ErrExitTimeout
 )
 
 var errMsgs = errors.Messages{
 	ErrServerOutdated:      "server outdated",
 	ErrMonitoringCancelled: "monitoring cancelled",
 	ErrCmdReceiveTimeout:   "command not applied, timeout",
+	ErrExitTimeout:         "openvpn is not exiting, timeout",
 }
 
 func init() { errors.InjectMessages(errMsgs) }
@@ -20,6 +20,7 @@ type Config struct {
 	ByteCountPeriod uint // In seconds.
 	CmdApplyTimeout uint // In seconds.
 	CmdRetryTimeout uint // In seconds.
+	ExitTimeout     uint // Wait for OpenVPN to exit, in seconds.
 }
 
 // NewConfig creates a default configuration for OpenVPN monitor.
@@ -29,6 +30,7 @@ func NewConfig() *Config {
 		ByteCountPeriod: 5,
 		CmdApplyTimeout: 10,
 		CmdRetryTimeout: 3,
+		ExitTimeout:     5,
 	}
 }
 
@@ -58,6 +60,8 @@ type Monitor struct {
 	clientConnected bool
 	mu              sync.RWMutex
 	out             *bufio.Reader // Openvpn output.
+	username        string        // Answer to client mode auth queries.
+	password        string
 }
 
 // NewMonitor creates a new OpenVPN monitor.
@@ -71,6 +75,15 @@ func NewMonitor(conf *Config, logger log.Logger,
 	}
 }
 
+// SetAuth sets credentials, which are sent to OpenVPN when it queries them
+// through the management interface in client mode.
+func (m *Monitor) SetAuth(username, password string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.username = username
+	m.password = password
+}
+
 // Close immediately closes the monitor making MonitorTraffic() to return.
 func (m *Monitor) Close() error {
 	if m.conn != nil {
@@ -80,7 +93,8 @@ func (m *Monitor) Close() error {
 }
 
 // MonitorTraffic connects to OpenVPN management interfaces and starts
-// monitoring VPN traffic.
+// monitoring VPN traffic. In client mode, when the context is cancelled,
+// the monitor stops OpenVPN through the management interface.
 func (m *Monitor) MonitorTraffic(ctx context.Context) error {
 	logger := m.logger.Add("method", "MonitorTraffic")
 	logger.Info("dapp-openvpn monitor started")
@@ -97,24 +111,116 @@ func (m *Monitor) MonitorTraffic(ctx context.Context) error {
 		return err
 	}
 
+	done := make(chan struct{})
+	defer close(done)
+
+	lines := make(chan string)
+	errs := make(chan error, 1)
+	go m.read(lines, errs, done)
+
 	for {
 		select {
 		case <-ctx.Done():
 			logger.Debug("context cancelled, exiting")
+			if len(m.channel) != 0 {
+				m.shutdown(lines, errs)
+			}
 			return ErrMonitoringCancelled
-		default:
-			str, err := m.out.ReadString('\n')
-			if err != nil {
+		case str := <-lines:
+			if err := m.processReply(str); err != nil {
 				return err
 			}
+		case err := <-errs:
+			return err
+		}
+	}
+}
 
-			if err = m.processReply(str); err != nil {
-				return err
+// read passes OpenVPN output lines to a given channel until a read error.
+func (m *Monitor) read(lines chan<- string, errs chan<- error,
+	done <-chan struct{}) {
+	for {
+		str, err := m.out.ReadString('\n')
+		if err != nil {
+			errs <- err
+			return
+		}
+
+		select {
+		case lines <- str:
+		case <-done:
+			return
+		}
+	}
+}
+
+// shutdown captures final byte counts of a client session, then asks
+// OpenVPN to exit and waits until it is exiting.
+func (m *Monitor) shutdown(lines <-chan string, errs <-chan error) {
+	logger := m.logger.Add("method", "shutdown")
+
+	if err := m.write("status"); err != nil {
+		logger.Warn("failed to request status: " + err.Error())
+		return
+	}
+
+	if err := m.write("signal SIGTERM"); err != nil {
+		logger.Warn("failed to send SIGTERM: " + err.Error())
+		return
+	}
+
+	var up, down uint64
+	timeout := time.After(time.Duration(m.conf.ExitTimeout) * time.Second)
+	for {
+		select {
+		case str := <-lines:
+			var err error
+			switch {
+			case strings.HasPrefix(str, prefixStatusRead):
+				down, err = strconv.ParseUint(
+					split(str[len(prefixStatusRead):])[0], 10, 64)
+			case strings.HasPrefix(str, prefixStatusWrite):
+				up, err = strconv.ParseUint(
+					split(str[len(prefixStatusWrite):])[0], 10, 64)
+			case strings.HasPrefix(str, prefixStatusEnd):
+				m.updateFinal(up, down)
+			case strings.HasPrefix(str, prefixState):
+				sp := split(str[len(prefixState):])
+				if len(sp) > 1 && sp[1] == "EXITING" {
+					logger.Info("openvpn is exiting")
+					return
+				}
+			}
+			if err != nil {
+				logger.Warn("failed to parse status: " + err.Error())
 			}
+		case err := <-errs:
+			logger.Debug("openvpn disconnected: " + err.Error())
+			return
+		case <-timeout:
+			logger.Warn(ErrExitTimeout.Error())
+			return
 		}
 	}
 }
 
+// updateFinal updates a client session with final byte counts. It's a sync
+// call, so that the counts are stored before the session is stopped.
+func (m *Monitor) updateFinal(up, down uint64) {
+	m.mtx.Lock()
+	connected := m.clientConnected
+	m.mtx.Unlock()
+
+	if !connected {
+		return
+	}
+
+	m.logger.Add("method", "updateFinal").Info(fmt.Sprintf(
+		"openvpn final byte count: up %d, down %d", up, down))
+
+	m.sessionHandler.UpdateSession(m.channel, up, down)
+}
+
 func (m *Monitor) writeAndWaitForSuccess(cmd string) error {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
@@ -185,10 +291,40 @@ func (m *Monitor) lookForPrefixOutput(timeout time.Duration, prefix string) erro
 			if err != nil || strings.HasPrefix(out, prefix) {
 				return err
 			}
+			// A query may come before the command is received.
+			if strings.HasPrefix(out, prefixPasswordNeed) {
+				if err := m.writeAuth(); err != nil {
+					return err
+				}
+			}
 		}
 	}
 }
 
+// quote quotes a management interface command parameter.
+func quote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+}
+
+// writeAuth answers an OpenVPN credentials query. The caller holds m.mtx.
+func (m *Monitor) writeAuth() error {
+	m.logger.Add("method", "writeAuth").Info(
+		"sending credentials to openvpn")
+
+	if err := m.writeCommand(
+		"username \"Auth\" " + quote(m.username)); err != nil {
+		return err
+	}
+	return m.writeCommand("password \"Auth\" " + quote(m.password))
+}
+
+func (m *Monitor) sendAuth() error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.writeAuth()
+}
+
 func (m *Monitor) requestClients() error {
 	m.logger.Info("requesting updated client list")
 	return m.write("status 2")
@@ -242,6 +378,11 @@ const (
 	prefixError             = "ERROR: "
 	prefixState             = ">STATE:"
 	prefixCMDSuccess        = "SUCCESS: "
+	prefixStatusRead        = "TCP/UDP read bytes,"
+	prefixStatusWrite       = "TCP/UDP write bytes,"
+	prefixStatusEnd         = "END"
+	prefixPasswordNeed      = ">PASSWORD:Need 'Auth'"
+	prefixPasswordFailed    = ">PASSWORD:Verification Failed: 'Auth'"
 )
 
 func (m *Monitor) processReply(s string) error {
@@ -274,6 +415,14 @@ func (m *Monitor) processReply(s string) error {
 		return m.processState(s[len(prefixState):])
 	}
 
+	if strings.HasPrefix(s, prefixPasswordNeed) {
+		return m.sendAuth()
+	}
+
+	if strings.HasPrefix(s, prefixPasswordFailed) {
+		logger.Error("openvpn rejected credentials")
+	}
+
 	if strings.HasPrefix(s, prefixError) {
 		logger.Error("openvpn error: " + s[len(prefixError):])
 	}
@@ -40,6 +40,17 @@ var (
 
 func connect(t *testing.T, handler SessionHandler,
 	channel string) (net.Conn, <-chan error) {
+	return connectWithContext(context.Background(), t, handler, channel)
+}
+
+func connectWithContext(ctx context.Context, t *testing.T,
+	handler SessionHandler, channel string) (net.Conn, <-chan error) {
+	return connectMonitor(ctx, t,
+		NewMonitor(conf.VPNMonitor, logger, handler, channel))
+}
+
+func connectMonitor(ctx context.Context, t *testing.T,
+	mon *Monitor) (net.Conn, <-chan error) {
 	lst, err := net.Listen("tcp", conf.VPNMonitor.Addr)
 	if err != nil {
 		t.Fatalf("failed to listen: %s", err)
@@ -51,9 +62,7 @@ func connect(t *testing.T, handler SessionHandler,
 
 	ch := make(chan error)
 	go func() {
-		mon := NewMonitor(
-			conf.VPNMonitor, logger, handler, channel)
-		ch <- mon.MonitorTraffic(context.Background())
+		ch <- mon.MonitorTraffic(ctx)
 		mon.Close()
 	}()
 
@@ -303,6 +312,85 @@ func TestClientSessionEvents(t *testing.T) {
 	exit(t, conn, ch)
 }
 
+func TestClientShutdown(t *testing.T) {
+	sessHandler := newTestHandler(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, ch := connectWithContext(ctx, t, sessHandler, testChannel)
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	receive(t, reader)
+	send(t, conn, prefixCMDSuccess+"\n")
+	receive(t, reader)
+	send(t, conn, prefixCMDSuccess+"\n")
+	receive(t, reader)
+	send(t, conn, prefixCMDSuccess+"\n")
+
+	if runtime.GOOS == "windows" {
+		receive(t, reader)
+	}
+
+	sendClientState(t, conn, true)
+	<-sessHandler.events
+
+	cancel()
+
+	if str := receive(t, reader); str != "status" {
+		t.Fatalf("unexpected status command: %s", str)
+	}
+	if str := receive(t, reader); str != "signal SIGTERM" {
+		t.Fatalf("unexpected signal command: %s", str)
+	}
+
+	send(t, conn, fmt.Sprintf("%s%d", prefixStatusRead, down))
+	send(t, conn, fmt.Sprintf("%s%d", prefixStatusWrite, up))
+	send(t, conn, prefixStatusEnd)
+
+	data := <-sessHandler.events
+	if data.method != "UpdateSession" ||
+		data.ch != testChannel ||
+		data.down != down || data.up != up {
+		t.Fatalf("wrong final up/down in client mode")
+	}
+
+	send(t, conn, prefixState+"0,EXITING,SIGTERM,,")
+
+	expectExit(t, ch, ErrMonitoringCancelled)
+}
+
+func TestClientAuth(t *testing.T) {
+	mon := NewMonitor(conf.VPNMonitor, logger, &testHandler{}, testChannel)
+	mon.SetAuth("user", `pa"ss\word`)
+	conn, ch := connectMonitor(context.Background(), t, mon)
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	receive(t, reader)
+	send(t, conn, prefixCMDSuccess+"\n")
+	receive(t, reader)
+	send(t, conn, prefixCMDSuccess+"\n")
+	receive(t, reader)
+	send(t, conn, prefixCMDSuccess+"\n")
+
+	if runtime.GOOS == "windows" {
+		receive(t, reader)
+		send(t, conn, prefixCMDSuccess+"\n")
+	}
+
+	send(t, conn, prefixPasswordNeed+" username/password")
+
+	if str := receive(t, reader); str != `username "Auth" "user"` {
+		t.Fatalf("unexpected username command: %s", str)
+	}
+	if str := receive(t, reader); str != `password "Auth" "pa\"ss\\word"` {
+		t.Fatalf("unexpected password command: %s", str)
+	}
+
+	exit(t, conn, ch)
+}
+
 func TestKill(t *testing.T) {
 	sessHandler := newTestHandler(false)
 	conn, ch := connect(t, sessHandler, "")
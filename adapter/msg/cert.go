@@ -0,0 +1,91 @@
+package msg
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/privatix/dappctrl/util/log"
+)
+
+// certificates parses all certificates from a PEM file. A file may contain
+// several certificate authorities during a CA rotation.
+func certificates(logger log.Logger,
+	file string) ([]*x509.Certificate, error) {
+	logger = logger.Add("method", "certificates", "file", file)
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, ErrReadCert
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			logger.Error(err.Error())
+			return nil, ErrParseCert
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		logger.Error("no certificates found")
+		return nil, ErrFindCert
+	}
+	return certs, nil
+}
+
+// checkExpiry logs a warning for every certificate in a file which expires
+// in less than a given period and an error for every expired one.
+func checkExpiry(logger log.Logger, file string, period time.Duration,
+	now time.Time) error {
+	certs, err := certificates(logger, file)
+	if err != nil {
+		return err
+	}
+
+	for _, cert := range certs {
+		logger := logger.Add("file", file,
+			"subject", cert.Subject.CommonName,
+			"notAfter", cert.NotAfter.Format(time.RFC3339))
+
+		left := cert.NotAfter.Sub(now)
+		switch {
+		case left <= 0:
+			logger.Error("certificate has expired")
+		case left < period:
+			logger.Warn(fmt.Sprintf("certificate expires in %d days",
+				int(left.Hours()/24)))
+		}
+	}
+	return nil
+}
+
+// CheckCertificates warns about expiring certificates of the server.
+func (p *Pusher) CheckCertificates() {
+	logger := p.logger.Add("method", "CheckCertificates")
+
+	period := time.Duration(p.config.ExpiryWarning) * 24 * time.Hour
+	now := time.Now()
+
+	for _, file := range []string{p.config.CaCertPath,
+		p.config.ServerCertPath} {
+		if len(file) == 0 {
+			continue
+		}
+		checkExpiry(logger, file, period, now)
+	}
+}
@@ -0,0 +1,81 @@
+// +build !nomsgtest
+
+package msg
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/privatix/dappctrl/util"
+)
+
+func testCertificate(t *testing.T, name string, notAfter time.Time) []byte {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl,
+		&priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestCertificates(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", util.NewUUID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootDir)
+
+	now := time.Now()
+	bundle := append(testCertificate(t, "new", now.AddDate(10, 0, 0)),
+		testCertificate(t, "old", now.AddDate(0, 0, 10))...)
+
+	file := filepath.Join(rootDir, caFileName)
+	if err := ioutil.WriteFile(file, bundle, filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	certs, err := certificates(logger, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 || certs[0].Subject.CommonName != "new" ||
+		certs[1].Subject.CommonName != "old" {
+		t.Fatal("wrong certificates in the bundle")
+	}
+
+	if err := checkExpiry(logger, file, 30*24*time.Hour, now); err != nil {
+		t.Fatal(err)
+	}
+
+	empty := filepath.Join(rootDir, "empty.crt")
+	if err := ioutil.WriteFile(empty, nil, filePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := certificates(logger, empty); err != ErrFindCert {
+		t.Fatalf("expected %v, got %v", ErrFindCert, err)
+	}
+}
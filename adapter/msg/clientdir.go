@@ -0,0 +1,116 @@
+package msg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/privatix/dappctrl/util/log"
+)
+
+// paramsHashFile keeps a hash of parameters a client directory is made for.
+const paramsHashFile = "params.hash"
+
+func hashDestination(dir string) string {
+	return filepath.Join(dir, paramsHashFile)
+}
+
+// paramsHash returns a hash of parameters and a template of a client
+// configuration.
+func paramsHash(serviceEndpointAddress, username string, params []byte,
+	options map[string]interface{}, tpl []byte) (string, error) {
+	opts, err := json.Marshal(options)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	for _, v := range [][]byte{[]byte(serviceEndpointAddress),
+		[]byte(username), params, opts, tpl} {
+		h.Write(v)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// isCurrent checks if a client directory is made for parameters with
+// a given hash.
+func isCurrent(dir, hash string) bool {
+	data, err := ioutil.ReadFile(hashDestination(dir))
+	return err == nil && bytes.Equal(bytes.TrimSpace(data), []byte(hash))
+}
+
+// wipeFile overwrites a file with zeros before removing it.
+func wipeFile(name string, size int64) error {
+	f, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(make([]byte, size))
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// WipeDir overwrites files of a client directory, so that keys do not
+// remain on disk, and removes the directory.
+func WipeDir(dir string) error {
+	err := filepath.Walk(dir,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			return wipeFile(path, info.Size())
+		})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// CleanClientDirs wipes client directories in a root directory, which are
+// not modified for longer than a given age. Directories without a client
+// configuration are kept.
+func CleanClientDirs(logger log.Logger, root string, age time.Duration) {
+	logger = logger.Add("method", "CleanClientDirs", "root", root)
+
+	items, err := ioutil.ReadDir(root)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("failed to read directory: " + err.Error())
+		}
+		return
+	}
+
+	for _, v := range items {
+		dir := filepath.Join(root, v.Name())
+		stat, err := os.Stat(configDestination(dir))
+		if !v.IsDir() || err != nil ||
+			time.Since(stat.ModTime()) < age {
+			continue
+		}
+
+		if err := WipeDir(dir); err != nil {
+			logger.Add("directory", dir).Warn(
+				"failed to wipe directory: " + err.Error())
+			continue
+		}
+		logger.Add("directory", dir).Info("stale directory wiped")
+	}
+}
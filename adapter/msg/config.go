@@ -2,7 +2,6 @@ package msg
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"path/filepath"
 	"runtime"
@@ -11,11 +10,13 @@ import (
 
 	"github.com/privatix/dappctrl/util"
 	"github.com/privatix/dappctrl/util/log"
+
+	vpndata "github.com/privatix/dapp-openvpn/adapter/data"
 )
 
 const (
-	defaultAccessFile     = "access.ovpn"
-	defaultCipher         = "AES-256-CBC"
+	defaultCipher         = "AES-256-GCM"
+	defaultDataCiphers    = "AES-256-GCM:AES-128-GCM:CHACHA20-POLY1305"
 	defaultConnectRetry   = "5"
 	defaultManagementPort = 7605
 	defaultPing           = "10"
@@ -33,6 +34,10 @@ const (
 
 	tcp       = "tcp"
 	tcpServer = "tcp-server"
+
+	chacha20        = "CHACHA20-POLY1305"
+	compressionNo   = "no"
+	compressionAsym = "asym"
 )
 
 // Specific adapter options.
@@ -42,35 +47,49 @@ const (
 	VpnManagementPort = "vpnManagementPort"
 	UpScript          = "upScript"
 	DownScript        = "downScript"
+	OpenVPNVersion    = "openvpnVersion"
+	RoutePolicy       = "routePolicy"
+	RouteNetworks     = "routeNetworks"
+	TemplateDir       = "templateDir"
+	ExtraDirectives   = "extraDirectives"
 )
 
-var (
-	vpnConfigTpl = template.New(clientTemplateName)
-)
+// defaultDNS are DNS servers accepted from agents, which do not push their
+// own.
+var defaultDNS = []string{"8.8.8.8", "8.8.4.4"}
 
 type vpnClient struct {
-	AccessFile     string `json:"-"`
-	Ca             string `json:"caData"`
-	Cipher         string `json:"cipher"`
-	ConnectRetry   string `json:"connect-retry"`
-	CompLZO        string `json:"comp-lzo"`
-	LogAppend      string `json:"-"`
-	ManagementPort uint16 `json:"-"`
-	Ping           string `json:"ping"`
-	PingRestart    string `json:"ping-restart"`
-	Port           string `json:"port"`
-	Proto          string `json:"proto"`
-	ServerAddress  string `json:"-"`
-	TapInterface   string `json:"-"`
-	UpScript       string `json:"-"`
-	DownScript     string `json:"-"`
+	AllowCompression    string
+	Ca                  string
+	Cipher              string
+	ConnectRetry        string
+	CompLZO             string
+	DataCiphers         string
+	DataCiphersFallback string
+	DNS                 []string
+	LogAppend           string
+	ManagementPort      uint16
+	NCPCiphers          string
+	Ping                string
+	PingRestart         string
+	Port                string
+	Proto               string
+	RoutePolicy         string
+	Routes              []route
+	Server              string
+	ServerAddress       string
+	TapInterface        string
+	TLSKey              string
+	TLSKeyMode          string
+	UpScript            string
+	DownScript          string
+	Version             ovpnVersion
 }
 
 type service struct{ logger log.Logger }
 
 func defaultVpnConfig() *vpnClient {
 	return &vpnClient{
-		AccessFile:     defaultAccessFile,
 		Cipher:         defaultCipher,
 		ConnectRetry:   defaultConnectRetry,
 		ManagementPort: defaultManagementPort,
@@ -79,11 +98,13 @@ func defaultVpnConfig() *vpnClient {
 		Port:           defaultServerPort,
 		Proto:          defaultProto,
 		ServerAddress:  defaultServerAddress,
+		Version:        defaultVersion,
+		DNS:            defaultDNS,
 	}
 }
 
 func (s *service) fillClientConfig(serviceEndpointAddress string,
-	additionalParams []byte) (*vpnClient, error) {
+	params *vpndata.Params) (*vpnClient, error) {
 	logger := s.logger.Add("method", "fillClientConfig",
 		"serviceEndpointAddress", serviceEndpointAddress)
 
@@ -95,17 +116,49 @@ func (s *service) fillClientConfig(serviceEndpointAddress string,
 
 	cfg := defaultVpnConfig()
 
-	if err := json.Unmarshal(additionalParams, cfg); err != nil {
-		s.logger.Error(err.Error())
-		return nil, ErrDecodeParams
+	set := func(dst *string, value string) {
+		if len(value) != 0 {
+			*dst = value
+		}
 	}
 
-	if existParam(paramCompLZO, additionalParams) {
+	set(&cfg.AllowCompression, params.AllowCompression)
+	set(&cfg.Ca, params.Ca)
+	set(&cfg.Cipher, params.Cipher)
+	set(&cfg.ConnectRetry, params.ConnectRetry)
+	set(&cfg.DataCiphers, params.DataCiphers)
+	set(&cfg.DataCiphersFallback, params.DataCiphersFallback)
+	set(&cfg.NCPCiphers, params.NCPCiphers)
+	set(&cfg.Ping, params.Ping)
+	set(&cfg.PingRestart, params.PingRestart)
+	set(&cfg.Port, params.Port)
+	set(&cfg.Server, params.Server)
+	set(&cfg.TLSKey, params.TLSKey)
+	set(&cfg.TLSKeyMode, params.TLSKeyMode)
+
+	if dns := params.DNSServers(); len(dns) != 0 {
+		cfg.DNS = dns
+	}
+
+	if !validTLSKeyMode(cfg.TLSKeyMode) ||
+		(len(cfg.TLSKeyMode) != 0 && len(cfg.TLSKey) == 0) {
+		logger.Error(ErrBadTLSKeyMode.Error())
+		return nil, ErrBadTLSKeyMode
+	}
+
+	if len(cfg.Server) != 0 {
+		if _, err := subnetPrefix(cfg.Server); err != nil {
+			logger.Error(err.Error())
+			return nil, err
+		}
+	}
+
+	if params.CompLZO != nil {
 		cfg.CompLZO = paramCompLZO
 	}
 
 	cfg.ServerAddress = serviceEndpointAddress
-	cfg.Proto = proto(additionalParams)
+	cfg.Proto = proto(params.Proto)
 
 	return cfg, nil
 }
@@ -114,7 +167,8 @@ func (s *service) genClientConfig(text string,
 	data interface{}) ([]byte, error) {
 	logger := s.logger.Add("method", "genClientConfig")
 
-	tpl, err := vpnConfigTpl.Parse(text)
+	tpl, err := template.New(clientTemplateName).Funcs(
+		templateFuncs).Parse(text)
 	if err != nil {
 		logger.Error(err.Error())
 		return nil, ErrParseConfigTemplate
@@ -133,10 +187,6 @@ func configDestination(dir string) string {
 	return filepath.Join(dir, clientConfigFile)
 }
 
-func accessDestination(dir string) string {
-	return filepath.Join(dir, defaultAccessFile)
-}
-
 func pathToConfig(path string) string {
 	if runtime.GOOS == "windows" {
 		str := strings.Replace(path, `\`, `\\`, -1)
@@ -145,13 +195,6 @@ func pathToConfig(path string) string {
 	return path
 }
 
-// addAccessFile adds full path to an access file to a configuration.
-func (s *service) addAccessFile(dir string, openVpnConfig *vpnClient) {
-	accessDst := accessDestination(dir)
-	openVpnConfig.AccessFile = pathToConfig(accessDst)
-
-}
-
 // addLogAppend adds full path to Openvpn log file to a configuration.
 func (s *service) addLogAppend(username string,
 	options map[string]interface{}, openVpnConfig *vpnClient) {
@@ -161,12 +204,15 @@ func (s *service) addLogAppend(username string,
 	}
 
 	if dir, ok := ovpnLogDir.(string); ok {
-		logName := fmt.Sprintf("openvpn-%s.log", username)
-		openVpnConfig.LogAppend = pathToConfig(
-			filepath.Join(dir, logName))
+		openVpnConfig.LogAppend = pathToConfig(LogFile(dir, username))
 	}
 }
 
+// LogFile returns a path to OpenVPN log file of a channel.
+func LogFile(dir, channel string) string {
+	return filepath.Join(dir, fmt.Sprintf("openvpn-%s.log", channel))
+}
+
 // addVpnManagementPort adds vpn management port to the configuration.
 func (s *service) addVpnManagementPort(options map[string]interface{},
 	openVpnConfig *vpnClient) {
@@ -180,6 +226,21 @@ func (s *service) addVpnManagementPort(options map[string]interface{},
 	}
 }
 
+// addVersion adds version of the local OpenVPN to the configuration.
+func (s *service) addVersion(options map[string]interface{},
+	openVpnConfig *vpnClient) {
+	ver, ok := options[OpenVPNVersion]
+	if !ok {
+		return
+	}
+
+	if str, ok := ver.(string); ok {
+		if v, ok := parseVersion(str); ok {
+			openVpnConfig.Version = v
+		}
+	}
+}
+
 // addTapInterface adds Windows TAP device name to the configuration.
 func (s *service) addTapInterface(options map[string]interface{},
 	openVpnConfig *vpnClient) {
@@ -189,6 +250,30 @@ func (s *service) addTapInterface(options map[string]interface{},
 	}
 }
 
+// addRoutePolicy adds a client route policy to the configuration.
+func (s *service) addRoutePolicy(options map[string]interface{},
+	openVpnConfig *vpnClient) error {
+	logger := s.logger.Add("method", "addRoutePolicy")
+
+	policy, _ := options[RoutePolicy].(string)
+	networks, _ := options[RouteNetworks].([]string)
+
+	if !validRoutePolicy(policy) {
+		logger.Error(ErrBadRoutePolicy.Error())
+		return ErrBadRoutePolicy
+	}
+
+	routes, err := routePolicyRoutes(policy, networks)
+	if err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+
+	openVpnConfig.RoutePolicy = policy
+	openVpnConfig.Routes = routes
+	return nil
+}
+
 // addUpScript adds MacOS up script to the configuration.
 func (s *service) addUpScript(options map[string]interface{},
 	openVpnConfig *vpnClient) {
@@ -208,9 +293,15 @@ func (s *service) addDownScript(options map[string]interface{},
 }
 
 func (s *service) makeClientConfig(dir, serviceEndpointAddress, username string,
-	params []byte, options map[string]interface{}) error {
+	data []byte, options map[string]interface{}, tpl []byte) error {
 	logger := s.logger.Add("method", "makeClientConfig", "directory", dir)
 
+	params, err := vpndata.DecodeParams(data)
+	if err != nil {
+		logger.Error(err.Error())
+		return ErrDecodeParams
+	}
+
 	// Fills client configuration from service endpoint address and
 	// and parameters received from a agent.
 	openVpnConfig, err := s.fillClientConfig(serviceEndpointAddress, params)
@@ -218,22 +309,37 @@ func (s *service) makeClientConfig(dir, serviceEndpointAddress, username string,
 		return err
 	}
 
-	s.addAccessFile(dir, openVpnConfig)
 	s.addLogAppend(username, options, openVpnConfig)
 	s.addVpnManagementPort(options, openVpnConfig)
 	s.addTapInterface(options, openVpnConfig)
+	s.addVersion(options, openVpnConfig)
 	s.addUpScript(options, openVpnConfig)
 	s.addDownScript(options, openVpnConfig)
 
-	data, err := readFileFromVirtualFS(clientConfigTemplate)
-	if err != nil {
-		logger.Error(err.Error())
+	if err := s.addRoutePolicy(options, openVpnConfig); err != nil {
 		return err
 	}
 
 	// Fills configuration template.
-	configuration, err := s.genClientConfig(string(data), openVpnConfig)
+	configuration, err := s.genClientConfig(string(tpl), openVpnConfig)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkOverride(configuration, tpl,
+		openVpnConfig); err != nil {
+		return err
+	}
+
+	directives, _ := options[ExtraDirectives].([]string)
+	configuration, err = appendDirectives(configuration, directives)
 	if err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+
+	if err := checkClientConfig(configuration); err != nil {
+		logger.Error(err.Error())
 		return err
 	}
 
@@ -245,70 +351,92 @@ func (s *service) makeClientConfig(dir, serviceEndpointAddress, username string,
 	return nil
 }
 
-// makes access file with username and password.
-func makeAccess(dir, username, password string) error {
-	data := fmt.Sprintf("%s\n%s\n", username, password)
-	return writeFile(accessDestination(dir), []byte(data))
+// checkOverride checks a config made from an overridden template against
+// a config made from the embedded one.
+func (s *service) checkOverride(configuration, tpl []byte,
+	openVpnConfig *vpnClient) error {
+	logger := s.logger.Add("method", "checkOverride")
+
+	embedded, err := readFileFromVirtualFS(clientConfigTemplate)
+	if err != nil {
+		logger.Error(err.Error())
+		return ErrParseConfigTemplate
+	}
+
+	if bytes.Equal(tpl, embedded) {
+		return nil
+	}
+
+	reference, err := s.genClientConfig(string(embedded), openVpnConfig)
+	if err != nil {
+		return err
+	}
+
+	if err := checkOverride(configuration, reference); err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+	return nil
 }
 
-// MakeFiles creates configuration files for a product.
-func MakeFiles(logger log.Logger, dir, serviceEndpointAddress, username,
-	password string, params []byte, options map[string]interface{}) error {
+// Credentials authenticate a client with an agent.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// MakeFiles creates configuration files for a product. Credentials are not
+// written, OpenVPN queries them through the management interface. Files
+// made for other parameters, e.g. of a changed endpoint, are wiped and made
+// anew.
+func MakeFiles(logger log.Logger, dir, serviceEndpointAddress,
+	username string, params []byte, options map[string]interface{}) error {
 	s := &service{logger: logger}
 
 	logger = logger.Add("method", "MakeFiles", "directory", dir)
 
-	configDst := configDestination(dir)
-	accessDst := accessDestination(dir)
+	tpl, err := readClientTemplate(options)
+	if err != nil {
+		logger.Error(err.Error())
+		return ErrParseConfigTemplate
+	}
 
-	// If the target directory does not exist,
-	// then creates target directory.
-	if notExist(dir) {
-		if err := makeDir(dir); err != nil {
-			logger.Error(err.Error())
-			return ErrCreateDir
-		}
+	hash, err := paramsHash(serviceEndpointAddress, username, params,
+		options, tpl)
+	if err != nil {
+		logger.Error(err.Error())
+		return ErrGenConfig
 	}
 
-	// If the configuration file does not exist,
-	// then make and fill client configuration file.
-	if !checkFile(configDst) {
-		if err := s.makeClientConfig(dir, serviceEndpointAddress,
-			username, params, options); err != nil {
-			return err
-		}
+	if checkFile(configDestination(dir)) && isCurrent(dir, hash) {
+		return nil
 	}
 
-	// If the access file does not exist, then make and fill access file.
-	if !checkFile(accessDst) {
-		if err := makeAccess(dir, username, password); err != nil {
-			logger.Error(err.Error())
-			return ErrCreateAccessFile
-		}
+	if err := WipeDir(dir); err != nil {
+		logger.Error(err.Error())
+		return ErrWipeDir
 	}
-	return nil
-}
 
-func variables(data []byte) (v map[string]string) {
-	v = make(map[string]string)
-	json.Unmarshal(data, &v)
-	return
-}
+	if err := makeDir(dir); err != nil {
+		logger.Error(err.Error())
+		return ErrCreateDir
+	}
 
-func existParam(key string, data []byte) bool {
-	v := variables(data)
+	if err := s.makeClientConfig(dir, serviceEndpointAddress,
+		username, params, options, tpl); err != nil {
+		return err
+	}
 
-	if _, ok := v[key]; !ok {
-		return false
+	if err := writeFile(hashDestination(dir), []byte(hash)); err != nil {
+		logger.Error(err.Error())
+		return ErrCreateConfig
 	}
-	return true
+	return nil
 }
 
-func proto(data []byte) string {
-	v := variables(data)
-
-	val, ok := v[paramProto]
-	if !ok {
+// proto returns a client protocol for a protocol of an agent.
+func proto(val string) string {
+	if len(val) == 0 {
 		return defaultProto
 	}
 
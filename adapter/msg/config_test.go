@@ -12,6 +12,7 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/privatix/dappctrl/util"
 )
@@ -19,6 +20,7 @@ import (
 const (
 	password               = "secret"
 	serviceEndpointAddress = "example.com"
+	legacyAccessFile       = "access.ovpn"
 
 	caDataKey = "caData"
 	remoteKey = "remote"
@@ -58,15 +60,18 @@ func testAdditionalParams(t *testing.T, parameters map[string]string) map[string
 	return result
 }
 
-func checkAccess(t *testing.T, file, username, password string) {
-	data, err := ioutil.ReadFile(file)
+func checkNoAccess(t *testing.T, file, config string) {
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("access file exists: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(config)
 	if err != nil {
 		t.Fatal(err)
 	}
-	expected := []byte(fmt.Sprintf("%s\n%s\n", username, password))
 
-	if !reflect.DeepEqual(data, expected) {
-		t.Fatalf("expected %s, got %s", expected, data)
+	if !strings.Contains(string(data), "management-query-passwords") {
+		t.Fatal("credentials are not queried through management")
 	}
 }
 
@@ -207,7 +212,7 @@ func TestMakeFiles(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	accessFile := filepath.Join(rootDir, defaultAccessFile)
+	accessFile := filepath.Join(rootDir, legacyAccessFile)
 	confFile := filepath.Join(rootDir, clientConfigFile)
 
 	options := map[string]interface{}{
@@ -217,11 +222,107 @@ func TestMakeFiles(t *testing.T) {
 	}
 
 	if err := MakeFiles(logger, rootDir, serviceEndpointAddress, username,
-		password, data, options); err != nil {
+		data, options); err != nil {
 		t.Fatal(err)
 	}
 
-	checkAccess(t, accessFile, username, password)
+	checkNoAccess(t, accessFile, confFile)
 	checkCA(t, confFile, []byte(params[caDataKey]))
 	checkConf(t, confFile, parameterKeys(conf.TestVPNConfig), options)
 }
+
+func readConf(t *testing.T, file string) string {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRegenerateFiles(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", util.NewUUID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(rootDir)
+
+	data, err := json.Marshal(testAdditionalParams(t, conf.TestVPNConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accessFile := filepath.Join(rootDir, legacyAccessFile)
+	confFile := filepath.Join(rootDir, clientConfigFile)
+
+	// Files made by an older version have no parameters hash.
+	for _, file := range []string{accessFile, confFile} {
+		if err := ioutil.WriteFile(file, []byte("stale"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	makeFiles := func(addr string) {
+		if err := MakeFiles(logger, rootDir, addr, username,
+			data, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	makeFiles("1.2.3.4")
+	checkNoAccess(t, accessFile, confFile)
+
+	// Files are kept while the parameters are the same.
+	if err := ioutil.WriteFile(confFile, []byte("kept"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	makeFiles("1.2.3.4")
+	if readConf(t, confFile) != "kept" {
+		t.Fatal("files are made for the same parameters")
+	}
+
+	makeFiles("1.2.3.5")
+	if !strings.Contains(readConf(t, confFile), "1.2.3.5") {
+		t.Fatal("files are not made for a changed endpoint")
+	}
+}
+
+func TestCleanClientDirs(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", util.NewUUID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(rootDir)
+
+	old := time.Now().Add(-2 * time.Hour)
+	dirs := map[string]bool{"stale": false, "fresh": true, "other": true}
+	for name := range dirs {
+		dir := filepath.Join(rootDir, name)
+		if err := os.Mkdir(dir, pathPerm); err != nil {
+			t.Fatal(err)
+		}
+
+		file := configDestination(dir)
+		if name == "other" {
+			file = filepath.Join(dir, "other.conf")
+		}
+		if err := ioutil.WriteFile(file, []byte("test"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if name != "fresh" {
+			if err := os.Chtimes(file, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	CleanClientDirs(logger, rootDir, time.Hour)
+
+	for name, kept := range dirs {
+		if notExist(filepath.Join(rootDir, name)) == kept {
+			t.Errorf("directory %s: expected kept %v", name, kept)
+		}
+	}
+}
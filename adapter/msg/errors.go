@@ -6,7 +6,7 @@ import "github.com/privatix/dappctrl/util/errors"
 const (
 	// CRC16("github.com/privatix/dapp-openvpn/adapter/msg") = 0x6D7F
 	ErrContextIsDone errors.Error = 0x6D7F<<8 + iota
-	ErrCreateAccessFile
+	ErrWipeDir
 	ErrCreateConfig
 	ErrCreateDir
 	ErrDecodeParams
@@ -16,11 +16,20 @@ const (
 	ErrReadCert
 	ErrReadConfig
 	ErrServiceEndpointAddr
+	ErrReadTLSKey
+	ErrBadTLSKey
+	ErrBadTLSKeyMode
+	ErrParseCert
+	ErrBadRoutePolicy
+	ErrBadRouteNetwork
+	ErrBadDirective
+	ErrBadClientConfig
+	ErrBadSubnet
 )
 
 var errMsgs = errors.Messages{
 	ErrContextIsDone:       "context is done",
-	ErrCreateAccessFile:    "failed to create access file",
+	ErrWipeDir:             "failed to wipe directory",
 	ErrCreateConfig:        "failed to create config",
 	ErrCreateDir:           "failed to create directory",
 	ErrDecodeParams:        "failed to decode additional params",
@@ -30,6 +39,15 @@ var errMsgs = errors.Messages{
 	ErrReadCert:            "failed to read certificate authority",
 	ErrReadConfig:          "failed to read config",
 	ErrServiceEndpointAddr: "invalid service endpoint address",
+	ErrReadTLSKey:          "failed to read tls key",
+	ErrBadTLSKey:           "invalid tls key",
+	ErrBadTLSKeyMode:       "unknown tls key mode",
+	ErrParseCert:           "failed to parse certificate",
+	ErrBadRoutePolicy:      "unknown route policy",
+	ErrBadRouteNetwork:     "invalid route network",
+	ErrBadDirective:        "invalid or unsafe extra directive",
+	ErrBadClientConfig:     "invalid client config",
+	ErrBadSubnet:           "agent subnet mask is not of whole octets",
 }
 
 func init() { errors.InjectMessages(errMsgs) }
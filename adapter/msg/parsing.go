@@ -47,6 +47,38 @@ func vpnParams(logger log.Logger, file string,
 	return params, err
 }
 
+// pushedDNS returns DNS servers, which a server pushes to clients, separated
+// by spaces.
+func pushedDNS(logger log.Logger, file string) (string, error) {
+	logger = logger.Add("method", "pushedDNS", "file", file)
+
+	f, err := os.Open(file)
+	if err != nil {
+		logger.Error(err.Error())
+		return "", ErrReadConfig
+	}
+	defer f.Close()
+
+	var servers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		words := strings.Fields(strings.Trim(
+			strings.TrimPrefix(strings.TrimSpace(scanner.Text()),
+				"push "), `"`))
+		if len(words) == 3 && words[0] == "dhcp-option" &&
+			words[1] == "DNS" {
+			servers = append(servers, words[2])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		logger.Error(err.Error())
+		return "", ErrReadConfig
+	}
+
+	return strings.Join(servers, " "), nil
+}
+
 func certificateAuthority(logger log.Logger,
 	file string) (ca []byte, err error) {
 	logger = logger.Add("method", "certificateAuthority", "file", file)
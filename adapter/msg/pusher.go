@@ -1,24 +1,35 @@
 package msg
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"io/ioutil"
-	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/rdegges/go-ipify"
 
 	"github.com/privatix/dappctrl/util/log"
+
+	vpndata "github.com/privatix/dapp-openvpn/adapter/data"
 )
 
 const (
 	caDataParameter        = "caData"
+	dnsParameter           = "dns"
+	versionParameter       = "version"
 	defaultIP              = "127.0.0.1"
 	serverAddressParameter = "externalIP"
+	tlsKeyDataParameter    = "tlsKeyData"
+	tlsKeyModeParameter    = "tlsKeyMode"
 
 	// PushedFile the name of a file that indicates that
 	// the configuration is already loaded on the server.
+	// It holds a hash of the pushed configuration.
 	PushedFile = "configPushed"
 	filePerm   = 0644
 )
@@ -29,6 +40,11 @@ type Config struct {
 	ConfigPath       string
 	ExportConfigKeys []string
 	TimeOut          int64
+	TLSKeyPath       string // Control channel protection key.
+	TLSKeyMode       string // tls-auth or tls-crypt.
+	ServerCertPath   string // Server certificate to check for expiry.
+	ExpiryWarning    int64  // Warn about expiring certificates, in days.
+	WatchInterval    int64  // Interval to check for changes, in seconds.
 }
 
 // SetProductConfigFunc sets controller's product configuration.
@@ -49,8 +65,12 @@ func NewConfig() *Config {
 	return &Config{
 		ExportConfigKeys: []string{"proto", "cipher", "ping-restart",
 			"ping", "connect-retry", "ca",
-			"comp-lzo", "keepalive", "port"},
-		TimeOut: 12,
+			"comp-lzo", "keepalive", "port", "data-ciphers",
+			"data-ciphers-fallback", "ncp-ciphers",
+			"allow-compression", "server"},
+		TimeOut:       12,
+		ExpiryWarning: 30,
+		WatchInterval: 300,
 	}
 }
 
@@ -74,14 +94,45 @@ func NewPusher(conf *Config, logger log.Logger,
 	}
 }
 
-// VpnParams parses the OpenVpn configuration file.
+// VpnParams parses the OpenVpn configuration file. Params are validated
+// against the additional params schema.
 func (p *Pusher) VpnParams() (map[string]string, error) {
+	logger := p.logger.Add("method", "VpnParams")
+
+	params, err := p.vpnParams()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, ErrDecodeParams
+	}
+
+	if err := vpndata.ValidateParams(data); err != nil {
+		logger.Error(err.Error())
+		return nil, ErrDecodeParams
+	}
+	return params, nil
+}
+
+func (p *Pusher) vpnParams() (map[string]string, error) {
 	vpnParams, err := vpnParams(p.logger, p.config.ConfigPath,
 		p.config.ExportConfigKeys)
 	if err != nil {
 		return nil, err
 	}
 
+	dns, err := pushedDNS(p.logger, p.config.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(dns) != 0 {
+		vpnParams[dnsParameter] = dns
+	}
+	vpnParams[versionParameter] = vpndata.ParamsVersion
+
 	ca, err := certificateAuthority(p.logger, p.config.CaCertPath)
 	if err != nil {
 		return nil, err
@@ -90,6 +141,19 @@ func (p *Pusher) VpnParams() (map[string]string, error) {
 	vpnParams[serverAddressParameter] = p.ip
 	vpnParams[caDataParameter] = string(ca)
 
+	if len(p.config.TLSKeyMode) == 0 {
+		return vpnParams, err
+	}
+
+	key, err := tlsKeyData(p.logger,
+		p.config.TLSKeyPath, p.config.TLSKeyMode)
+	if err != nil {
+		return nil, err
+	}
+
+	vpnParams[tlsKeyModeParameter] = p.config.TLSKeyMode
+	vpnParams[tlsKeyDataParameter] = key
+
 	return vpnParams, err
 }
 
@@ -120,18 +184,38 @@ func (p *Pusher) PushConfiguration(ctx context.Context,
 	return nil
 }
 
+// Hash returns a hash of the vpn configuration to find out whether it
+// changed since the last push.
+func (p *Pusher) Hash(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(params[k]))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 func externalIP() (string, error) {
 	return ipify.GetIp()
 }
 
-// IsDone checks if the vpn configuration is loaded to server.
-func IsDone(dir string) bool {
-	_, err := os.Stat(filepath.Join(dir, PushedFile))
-	return err == nil
+// IsDone checks if the vpn configuration with a given hash is loaded to
+// server.
+func IsDone(dir, hash string) bool {
+	data, err := ioutil.ReadFile(filepath.Join(dir, PushedFile))
+	return err == nil && bytes.Equal(bytes.TrimSpace(data), []byte(hash))
 }
 
 // Done makes configPushed file.
-func Done(dir string) error {
+func Done(dir, hash string) error {
 	file := filepath.Join(dir, PushedFile)
-	return ioutil.WriteFile(file, nil, filePerm)
+	return ioutil.WriteFile(file, []byte(hash), filePerm)
 }
@@ -85,13 +85,22 @@ func TestConfigPushedFile(t *testing.T) {
 
 	defer os.RemoveAll(rootDir)
 
-	if IsDone(rootDir) {
+	pusher := NewPusher(createTestConfig(t, rootDir), logger, nil)
+	params := map[string]string{"proto": "udp", "port": "443"}
+	hash := pusher.Hash(params)
+
+	if IsDone(rootDir, hash) {
 		t.Fatal("configuration not yet updated")
 	}
-	if err := Done(rootDir); err != nil {
+	if err := Done(rootDir, hash); err != nil {
 		t.Fatal(err)
 	}
-	if !IsDone(rootDir) {
+	if !IsDone(rootDir, hash) {
 		t.Fatal("configuration already updated")
 	}
+
+	params["port"] = "1194"
+	if IsDone(rootDir, pusher.Hash(params)) {
+		t.Fatal("changed configuration is considered as pushed")
+	}
 }
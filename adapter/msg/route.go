@@ -0,0 +1,122 @@
+package msg
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Client route policies.
+const (
+	RouteFull       = "full"        // All traffic goes through VPN.
+	RouteExcludeLAN = "exclude-lan" // Local networks stay out of VPN.
+	RouteInclude    = "include"     // Only given networks go through VPN.
+	RouteExclude    = "exclude"     // Given networks stay out of VPN.
+
+	// defaultSubnet is assumed when an agent does not export its subnet.
+	defaultSubnet = "10.217.3.0 255.255.255.0"
+
+	netGateway = "net_gateway"
+	vpnGateway = "vpn_gateway"
+)
+
+// localNetworks stay out of VPN with exclude-lan route policy.
+var localNetworks = []string{
+	"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16"}
+
+type route struct {
+	Network string
+	Mask    string
+	Gateway string
+}
+
+func validRoutePolicy(policy string) bool {
+	switch policy {
+	case "", RouteFull, RouteExcludeLAN, RouteInclude, RouteExclude:
+		return true
+	}
+	return false
+}
+
+// parseRoutes converts networks in CIDR notation to routes through a given
+// gateway.
+func parseRoutes(networks []string, gateway string) ([]route, error) {
+	var routes []route
+	for _, v := range networks {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(v))
+		if err != nil || network.IP.To4() == nil {
+			return nil, ErrBadRouteNetwork
+		}
+
+		routes = append(routes, route{
+			Network: network.IP.String(),
+			Mask:    net.IP(network.Mask).String(),
+			Gateway: gateway,
+		})
+	}
+	return routes, nil
+}
+
+// routePolicyRoutes returns routes which implement a route policy.
+func routePolicyRoutes(policy string, networks []string) ([]route, error) {
+	switch policy {
+	case RouteExcludeLAN:
+		return parseRoutes(localNetworks, netGateway)
+	case RouteInclude:
+		if len(networks) == 0 {
+			return nil, ErrBadRouteNetwork
+		}
+		return parseRoutes(networks, vpnGateway)
+	case RouteExclude:
+		return parseRoutes(networks, netGateway)
+	}
+	return nil, nil
+}
+
+// subnetPrefix returns a textual prefix of addresses in an agent's subnet,
+// e.g. "10.217.3." for "10.217.3.0 255.255.255.0". Pushed options are
+// filtered by the prefix, so only masks of whole octets are supported.
+func subnetPrefix(subnet string) (string, error) {
+	fields := strings.Fields(subnet)
+	if len(fields) != 2 {
+		return "", ErrBadSubnet
+	}
+
+	ip := net.ParseIP(fields[0]).To4()
+	mask := net.ParseIP(fields[1]).To4()
+	if ip == nil || mask == nil {
+		return "", ErrBadSubnet
+	}
+
+	ones, bits := net.IPMask(mask).Size()
+	if bits != 32 || ones < 8 || ones%8 != 0 {
+		return "", ErrBadSubnet
+	}
+
+	var prefix string
+	for i := 0; i < ones/8; i++ {
+		prefix += strconv.Itoa(int(ip[i])) + "."
+	}
+	return prefix, nil
+}
+
+// Subnet returns a textual prefix of addresses in the agent's subnet to
+// filter pushed options with.
+func (c *vpnClient) Subnet() string {
+	if prefix, err := subnetPrefix(c.Server); err == nil {
+		return prefix
+	}
+	prefix, _ := subnetPrefix(defaultSubnet)
+	return prefix
+}
+
+// RedirectsGateway checks whether a route policy sends all traffic through
+// VPN by default.
+func RedirectsGateway(policy string) bool {
+	return policy != RouteInclude
+}
+
+// RedirectGateway checks whether all traffic goes through VPN by default.
+func (c *vpnClient) RedirectGateway() bool {
+	return RedirectsGateway(c.RoutePolicy)
+}
@@ -0,0 +1,82 @@
+// +build !nomsgtest
+
+package msg
+
+import (
+	"reflect"
+	"testing"
+
+	vpndata "github.com/privatix/dapp-openvpn/adapter/data"
+)
+
+func TestSubnetPrefix(t *testing.T) {
+	tests := map[string]string{
+		"10.217.3.0 255.255.255.0": "10.217.3.",
+		"172.20.0.0 255.255.0.0":   "172.20.",
+		"10.0.0.0 255.0.0.0":       "10.",
+	}
+
+	for subnet, expected := range tests {
+		prefix, err := subnetPrefix(subnet)
+		if err != nil || prefix != expected {
+			t.Errorf("wrong prefix of %q: %q", subnet, prefix)
+		}
+	}
+
+	for _, subnet := range []string{"", "10.217.3.0",
+		"10.217.3.0 255.0.255.0", "10.217.3.0 128.0.0.0",
+		"10.8.0.0 255.255.240.0", "10.217.3.0 255.255.255.128"} {
+		if _, err := subnetPrefix(subnet); err != ErrBadSubnet {
+			t.Errorf("invalid subnet %q accepted", subnet)
+		}
+	}
+
+	c := &vpnClient{}
+	if c.Subnet() != "10.217.3." {
+		t.Errorf("wrong default subnet prefix: %q", c.Subnet())
+	}
+
+	s := &service{logger: logger}
+	params := &vpndata.Params{Server: "10.8.0.0 255.255.240.0"}
+	_, err := s.fillClientConfig("1.2.3.4", params)
+	if err != ErrBadSubnet {
+		t.Errorf("expected bad subnet error, got %v", err)
+	}
+}
+
+func TestRoutePolicyRoutes(t *testing.T) {
+	routes, err := routePolicyRoutes(RouteFull, []string{"1.2.3.0/24"})
+	if err != nil || routes != nil {
+		t.Fatalf("unexpected routes for full tunnel: %v, %v",
+			routes, err)
+	}
+
+	routes, err = routePolicyRoutes(RouteInclude,
+		[]string{"1.2.3.4/24", "5.6.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []route{
+		{"1.2.3.0", "255.255.255.0", vpnGateway},
+		{"5.6.0.0", "255.255.0.0", vpnGateway},
+	}
+	if !reflect.DeepEqual(routes, expected) {
+		t.Fatalf("wrong included routes: %v", routes)
+	}
+
+	routes, err = routePolicyRoutes(RouteExcludeLAN, nil)
+	if err != nil || len(routes) != len(localNetworks) ||
+		routes[0].Gateway != netGateway {
+		t.Fatalf("wrong local network routes: %v, %v", routes, err)
+	}
+
+	if _, err := routePolicyRoutes(RouteInclude, nil); err == nil {
+		t.Fatal("include policy without networks accepted")
+	}
+
+	_, err = routePolicyRoutes(RouteExclude, []string{"1.2.3.4"})
+	if err != ErrBadRouteNetwork {
+		t.Fatalf("expected %v, got %v", ErrBadRouteNetwork, err)
+	}
+}
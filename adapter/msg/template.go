@@ -0,0 +1,200 @@
+package msg
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are functions available in client config templates.
+var templateFuncs = template.FuncMap{
+	"default":  defaultValue,
+	"quote":    quoteArg,
+	"join":     strings.Join,
+	"contains": strings.Contains,
+}
+
+// defaultValue returns a default for an empty value, e.g.
+// {{.Port | default "443"}}.
+func defaultValue(def, value string) string {
+	if len(value) == 0 {
+		return def
+	}
+	return value
+}
+
+// quoteArg quotes an OpenVPN directive argument, e.g. a path with spaces.
+func quoteArg(arg string) string {
+	arg = strings.Replace(arg, `\`, `\\`, -1)
+	return `"` + strings.Replace(arg, `"`, `\"`, -1) + `"`
+}
+
+// readClientTemplate reads a client config template from a template
+// directory, if it's overridden there, or from the embedded ones.
+func readClientTemplate(options map[string]interface{}) ([]byte, error) {
+	if dir, _ := options[TemplateDir].(string); len(dir) != 0 {
+		file := filepath.Join(dir, filepath.Base(clientConfigTemplate))
+		data, err := ioutil.ReadFile(file)
+		if err == nil || !os.IsNotExist(err) {
+			return data, err
+		}
+	}
+	return readFileFromVirtualFS(clientConfigTemplate)
+}
+
+var (
+	directiveName = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+	inlineTag     = regexp.MustCompile(`^<([a-z][a-z0-9-]*)>$`)
+)
+
+// unsafeDirectives run commands or break the adapter control of OpenVPN,
+// so they are not accepted as extra directives. So are management ones.
+var unsafeDirectives = map[string]bool{
+	"auth-user-pass":        true,
+	"auth-user-pass-verify": true,
+	"cd":                    true,
+	"chroot":                true,
+	"client-connect":        true,
+	"client-disconnect":     true,
+	"config":                true,
+	"daemon":                true,
+	"down":                  true,
+	"iproute":               true,
+	"ipchange":              true,
+	"learn-address":         true,
+	"log":                   true,
+	"log-append":            true,
+	"plugin":                true,
+	"remap-usr1":            true,
+	"route-pre-down":        true,
+	"route-up":              true,
+	"script-security":       true,
+	"status":                true,
+	"tls-verify":            true,
+	"tmp-dir":               true,
+	"up":                    true,
+	"writepid":              true,
+}
+
+// CheckDirective checks that an extra directive is a single safe OpenVPN
+// option, e.g. "mssfix 1400".
+func CheckDirective(directive string) error {
+	if strings.ContainsAny(directive, "\r\n") {
+		return ErrBadDirective
+	}
+
+	fields := strings.Fields(directive)
+	if len(fields) == 0 || !directiveName.MatchString(fields[0]) ||
+		unsafeDirective(fields[0]) {
+		return ErrBadDirective
+	}
+	return nil
+}
+
+func unsafeDirective(name string) bool {
+	return unsafeDirectives[name] || strings.HasPrefix(name, "management")
+}
+
+// appendDirectives appends extra directives to a client config.
+func appendDirectives(config []byte, directives []string) ([]byte, error) {
+	if len(directives) == 0 {
+		return config, nil
+	}
+
+	buf := bytes.NewBuffer(config)
+	buf.WriteString("\n# Extra directives\n")
+	for _, v := range directives {
+		if err := CheckDirective(v); err != nil {
+			return nil, err
+		}
+		buf.WriteString(strings.TrimSpace(v) + "\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// directives returns directive lines of a config with normalized spaces.
+// Inline blocks are skipped.
+func directives(config []byte) []string {
+	var block string
+	var list []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(config))
+	for scanner.Scan() {
+		line := strings.Join(strings.Fields(scanner.Text()), " ")
+
+		if len(block) != 0 {
+			if line == "</"+block+">" {
+				block = ""
+			}
+			continue
+		}
+
+		if m := inlineTag.FindStringSubmatch(line); m != nil {
+			block = m[1]
+		} else if len(line) != 0 && line[0] != '#' && line[0] != ';' {
+			list = append(list, line)
+		}
+	}
+	return list
+}
+
+// checkOverride checks a config rendered from an overridden template. It
+// may only have those unsafe directives, which a reference config rendered
+// from the embedded template has, with the same arguments.
+func checkOverride(config, reference []byte) error {
+	allowed := make(map[string]bool)
+	for _, v := range directives(reference) {
+		allowed[v] = true
+	}
+
+	for _, v := range directives(config) {
+		if unsafeDirective(strings.Fields(v)[0]) && !allowed[v] {
+			return ErrBadDirective
+		}
+	}
+	return nil
+}
+
+// checkClientConfig parses a rendered client config. Each line is empty,
+// a comment, a directive or a part of an inline block, and a remote is set.
+func checkClientConfig(config []byte) error {
+	var block string
+	var remote bool
+
+	scanner := bufio.NewScanner(bytes.NewReader(config))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if len(block) != 0 {
+			if line == "</"+block+">" {
+				block = ""
+			}
+			continue
+		}
+
+		if len(line) == 0 || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if m := inlineTag.FindStringSubmatch(line); m != nil {
+			block = m[1]
+			continue
+		}
+
+		name := strings.Fields(line)[0]
+		if !directiveName.MatchString(name) {
+			return ErrBadClientConfig
+		}
+		remote = remote || name == "remote"
+	}
+
+	if scanner.Err() != nil || len(block) != 0 || !remote {
+		return ErrBadClientConfig
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+// +build !nomsgtest
+
+package msg
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/privatix/dappctrl/util"
+)
+
+func TestCheckDirective(t *testing.T) {
+	for directive, valid := range map[string]bool{
+		"mssfix 1400":              true,
+		"sndbuf 393216":            true,
+		"http-proxy proxy 8080":    true,
+		"":                         false,
+		"mssfix 1400\nup /bin/sh":  false,
+		"up /bin/sh":               false,
+		"script-security 3":        false,
+		"iproute /bin/ip":          false,
+		"status /tmp/status":       false,
+		"tmp-dir /tmp":             false,
+		"management-client-user x": false,
+		"<ca>":                     false,
+	} {
+		if err := CheckDirective(directive); (err == nil) != valid {
+			t.Errorf("%q: expected valid %v, got %v",
+				directive, valid, err)
+		}
+	}
+}
+
+func TestCheckClientConfig(t *testing.T) {
+	for config, valid := range map[string]bool{
+		"client\nremote 1.2.3.4 443\n":                true,
+		"# comment\nremote a 1\n<ca>\n- x -\n</ca>\n": true,
+		"client\n":                  false,
+		"remote a 1\n<ca>\n- x -\n": false,
+		"remote a 1\n{{.Port}}\n":   false,
+	} {
+		err := checkClientConfig([]byte(config))
+		if (err == nil) != valid {
+			t.Errorf("%q: expected valid %v, got %v",
+				config, valid, err)
+		}
+	}
+}
+
+func TestCheckOverride(t *testing.T) {
+	reference := []byte("remote a 1\nup /bin/up.sh\n" +
+		"management 127.0.0.1 7506\n")
+
+	for config, valid := range map[string]bool{
+		"remote b 2\nmssfix 1400\n":                   true,
+		"remote b 2\nup  /bin/up.sh\n":                true,
+		"remote b 2\n<ca>\nup /bin/sh\n</ca>\n":       true,
+		"remote b 2\nup /tmp/up.sh\n":                 false,
+		"remote b 2\nmanagement 0.0.0.0 7507\n":       false,
+		"remote b 2\nscript-security 2\nup /bin/sh\n": false,
+	} {
+		err := checkOverride([]byte(config), reference)
+		if (err == nil) != valid {
+			t.Errorf("%q: expected valid %v, got %v",
+				config, valid, err)
+		}
+	}
+}
+
+func TestTemplateOverride(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", util.NewUUID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(rootDir)
+
+	tpl := `client
+remote {{.ServerAddress}} {{.Port | default "443"}}
+dev-node {{.TapInterface | quote}}
+`
+	err = ioutil.WriteFile(filepath.Join(rootDir,
+		filepath.Base(clientConfigTemplate)), []byte(tpl), filePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(testAdditionalParams(t, conf.TestVPNConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(rootDir, "channel")
+	options := map[string]interface{}{
+		TemplateDir:     rootDir,
+		TapInterface:    "my tap",
+		ExtraDirectives: []string{"mssfix 1400"},
+	}
+
+	if err := MakeFiles(logger, dir, "1.2.3.4", username,
+		data, options); err != nil {
+		t.Fatal(err)
+	}
+
+	result := readConf(t, configDestination(dir))
+	for _, v := range []string{"remote 1.2.3.4 ", `dev-node "my tap"`,
+		"\nmssfix 1400\n"} {
+		if !strings.Contains(result, v) {
+			t.Errorf("%q is not found in config:\n%s", v, result)
+		}
+	}
+
+	options[ExtraDirectives] = []string{"up /bin/sh"}
+	if err := MakeFiles(logger, dir, "1.2.3.4", username,
+		data, options); err != ErrBadDirective {
+		t.Fatalf("expected bad directive error, got %v", err)
+	}
+
+	delete(options, ExtraDirectives)
+	err = ioutil.WriteFile(filepath.Join(rootDir,
+		filepath.Base(clientConfigTemplate)),
+		[]byte(tpl+"script-security 2\nup /bin/sh\n"), filePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MakeFiles(logger, dir, "1.2.3.4", username,
+		data, options); err != ErrBadDirective {
+		t.Fatalf("expected bad directive error, got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package msg
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/privatix/dappctrl/util/log"
+)
+
+// Control channel protection modes.
+const (
+	TLSAuth  = "tls-auth"
+	TLSCrypt = "tls-crypt"
+
+	staticKeyHeader = "-----BEGIN OpenVPN Static key V1-----"
+)
+
+func validTLSKeyMode(mode string) bool {
+	switch mode {
+	case "", TLSAuth, TLSCrypt:
+		return true
+	}
+	return false
+}
+
+// tlsKeyData returns key material which a client needs to pass the agent's
+// control channel protection. It's an OpenVPN static key shared by the
+// agent and all clients of the product.
+func tlsKeyData(logger log.Logger, file, mode string) (string, error) {
+	logger = logger.Add("method", "tlsKeyData", "file", file, "mode", mode)
+
+	if !validTLSKeyMode(mode) {
+		logger.Error(ErrBadTLSKeyMode.Error())
+		return "", ErrBadTLSKeyMode
+	}
+
+	key, err := ioutil.ReadFile(file)
+	if err != nil {
+		logger.Error(err.Error())
+		return "", ErrReadTLSKey
+	}
+
+	if !strings.Contains(string(key), staticKeyHeader) {
+		logger.Error(ErrBadTLSKey.Error())
+		return "", ErrBadTLSKey
+	}
+	return string(key), nil
+}
@@ -0,0 +1,46 @@
+// +build !nomsgtest
+
+package msg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/privatix/dappctrl/util"
+)
+
+func TestTLSKeyData(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", util.NewUUID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootDir)
+
+	key := staticKeyHeader + "\n00\n-----END OpenVPN Static key V1-----\n"
+	file := filepath.Join(rootDir, "ta.key")
+	if err := ioutil.WriteFile(file, []byte(key), filePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []string{TLSAuth, TLSCrypt} {
+		data, err := tlsKeyData(logger, file, mode)
+		if err != nil || data != key {
+			t.Fatalf("%s: wrong key data: %v", mode, err)
+		}
+	}
+
+	if _, err := tlsKeyData(logger, file,
+		"tls-crypt-v2"); err != ErrBadTLSKeyMode {
+		t.Fatalf("expected %v, got %v", ErrBadTLSKeyMode, err)
+	}
+
+	err = ioutil.WriteFile(file, []byte("garbage"), filePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tlsKeyData(logger, file, TLSCrypt); err != ErrBadTLSKey {
+		t.Fatalf("expected %v, got %v", ErrBadTLSKey, err)
+	}
+}
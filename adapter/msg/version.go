@@ -0,0 +1,92 @@
+package msg
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultVersion is assumed when the local OpenVPN version is unknown.
+// Configuration rendered for 2.4 is understood by 2.5 and 2.6.
+var defaultVersion = ovpnVersion{Major: 2, Minor: 4}
+
+var versionRegexp = regexp.MustCompile(`(\d+)\.(\d+)`)
+
+type ovpnVersion struct {
+	Major int
+	Minor int
+}
+
+func parseVersion(s string) (ovpnVersion, bool) {
+	m := versionRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return ovpnVersion{}, false
+	}
+
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return ovpnVersion{Major: major, Minor: minor}, true
+}
+
+func (v ovpnVersion) atLeast(major, minor int) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+	return v.Minor >= minor
+}
+
+// AtLeast checks that the local OpenVPN is not older than a given version.
+func (c *vpnClient) AtLeast(major, minor int) bool {
+	return c.Version.atLeast(major, minor)
+}
+
+// CipherList returns data channel ciphers supported by the local OpenVPN in
+// the order of preference of the agent.
+func (c *vpnClient) CipherList() []string {
+	list := c.DataCiphers
+	if len(list) == 0 {
+		list = c.NCPCiphers
+	}
+	if len(list) == 0 {
+		list = defaultDataCiphers
+	}
+
+	var ciphers []string
+	for _, v := range strings.Split(list, ":") {
+		v = strings.ToUpper(strings.TrimSpace(v))
+		if len(v) == 0 || (v == chacha20 && !c.AtLeast(2, 5)) {
+			continue
+		}
+		ciphers = append(ciphers, v)
+	}
+	return ciphers
+}
+
+// Ciphers returns data channel ciphers in the form accepted by
+// --data-ciphers and --ncp-ciphers.
+func (c *vpnClient) Ciphers() string {
+	return strings.Join(c.CipherList(), ":")
+}
+
+// Fallback returns a cipher for agents which can not negotiate ciphers.
+func (c *vpnClient) Fallback() string {
+	if len(c.DataCiphersFallback) != 0 {
+		return c.DataCiphersFallback
+	}
+	if len(c.Cipher) != 0 {
+		return c.Cipher
+	}
+	return defaultCipher
+}
+
+// Compression returns --allow-compression policy. Agents which still use
+// comp-lzo need the client to accept compressed packets.
+func (c *vpnClient) Compression() string {
+	if len(c.CompLZO) != 0 {
+		return compressionAsym
+	}
+	if len(c.AllowCompression) != 0 {
+		return c.AllowCompression
+	}
+	return compressionNo
+}
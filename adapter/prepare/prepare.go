@@ -1,6 +1,7 @@
 package prepare
 
 import (
+	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -17,15 +18,16 @@ type GetEndpointFunc func(clientKey string) (*data.Endpoint, error)
 
 // ClientConfig prepares configuration for Client. By the channel ID, finds a
 // endpoint on a session server. Creates client configuration files for using a
-// product.
+// product. Returns credentials for OpenVPN management interface queries.
 func ClientConfig(logger log.Logger, channel string,
-	adapterConfig *config.Config, getEndpoint GetEndpointFunc) error {
+	adapterConfig *config.Config,
+	getEndpoint GetEndpointFunc) (*msg.Credentials, error) {
 	logger = logger.Add("method", "ClientConfig", "channel", channel)
 
 	endpoint, err := getEndpoint(channel)
 	if err != nil {
 		logger.Error(err.Error())
-		return ErrGetEndpoint
+		return nil, ErrGetEndpoint
 	}
 
 	save := func(str *string) string {
@@ -40,12 +42,16 @@ func ClientConfig(logger log.Logger, channel string,
 
 	err = msg.MakeFiles(logger, target,
 		save(endpoint.ServiceEndpointAddress), save(endpoint.Username),
-		save(endpoint.Password), endpoint.AdditionalParams,
+		endpoint.AdditionalParams,
 		specificOptions(logger, adapterConfig))
 	if err != nil {
-		return ErrMakeConfig
+		return nil, ErrMakeConfig
 	}
-	return nil
+
+	return &msg.Credentials{
+		Username: save(endpoint.Username),
+		Password: save(endpoint.Password),
+	}, nil
 }
 
 // findTapInterface finds Windows TAP device name.
@@ -120,6 +126,53 @@ func findLogDir(logger log.Logger,
 	logger.Debug("directory for log files found")
 }
 
+// setRoutePolicy sets client route policy.
+func setRoutePolicy(logger log.Logger,
+	cfg *config.Config, options map[string]interface{}) {
+	logger = logger.Add("routePolicy", cfg.OpenVPN.RoutePolicy)
+
+	if cfg.OpenVPN.RoutePolicy == "" {
+		logger.Debug("route policy not set in the configuration")
+		return
+	}
+
+	options[msg.RoutePolicy] = cfg.OpenVPN.RoutePolicy
+	options[msg.RouteNetworks] = cfg.OpenVPN.RouteNetworks
+	logger.Debug("route policy found")
+}
+
+// setTemplates sets client config template overrides and extra directives.
+func setTemplates(logger log.Logger,
+	cfg *config.Config, options map[string]interface{}) {
+	logger = logger.Add("templateDir", cfg.OpenVPN.TemplateDir)
+
+	if cfg.OpenVPN.TemplateDir != "" {
+		options[msg.TemplateDir] = cfg.OpenVPN.TemplateDir
+		logger.Debug("template directory found")
+	}
+
+	if len(cfg.OpenVPN.ExtraDirectives) != 0 {
+		options[msg.ExtraDirectives] = cfg.OpenVPN.ExtraDirectives
+		logger.Debug("extra directives found")
+	}
+}
+
+// findOpenVPNVersion finds version of the local OpenVPN. OpenVPN exits with
+// a non-zero code after printing its version, so the exit code is ignored.
+func findOpenVPNVersion(logger log.Logger,
+	cfg *config.Config, options map[string]interface{}) {
+	logger = logger.Add("openvpn", cfg.OpenVPN.Name)
+
+	out, _ := exec.Command(cfg.OpenVPN.Name, "--version").Output()
+	if len(out) == 0 {
+		logger.Debug("OpenVPN version not found")
+		return
+	}
+
+	options[msg.OpenVPNVersion] = strings.SplitN(string(out), "\n", 2)[0]
+	logger.Debug("OpenVPN version found")
+}
+
 // SpecificOptions returns specific options for dappvpn.
 // These options will be used to create a product configuration.
 func specificOptions(logger log.Logger,
@@ -130,5 +183,8 @@ func specificOptions(logger log.Logger,
 	findTapInterface(logger, cfg, options)
 	findVpnManagementPort(logger, cfg, options)
 	findLogDir(logger, cfg, options)
+	findOpenVPNVersion(logger, cfg, options)
+	setRoutePolicy(logger, cfg, options)
+	setTemplates(logger, cfg, options)
 	return options
 }
@@ -70,15 +70,21 @@ func TestClientConfig(t *testing.T) {
 		return ept, nil
 	}
 
-	err = ClientConfig(logger, channel, adapterConfig, getEndpoint)
+	creds, err := ClientConfig(logger, channel, adapterConfig, getEndpoint)
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	if creds.Username != *ept.Username || creds.Password != *ept.Password {
+		t.Fatal("unexpected credentials")
+	}
+
 	target := filepath.Join(rootDir, channel)
 
 	checkFile(t, configDestination(target))
-	checkFile(t, accessDestination(target))
+	if _, err := os.Stat(accessDestination(target)); !os.IsNotExist(err) {
+		t.Fatalf("access file exists: %v", err)
+	}
 }
 
 func TestMain(m *testing.M) {
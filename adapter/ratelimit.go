@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	vpndata "github.com/privatix/dapp-openvpn/adapter/data"
+	"github.com/privatix/dapp-openvpn/adapter/tc"
+)
+
+// rateLimit is a rate limit of a connected client, it's kept to change
+// the rate limit while the client is connected.
+type rateLimit struct {
+	Iface    string
+	ClientIP string
+	Params   vpndata.OfferingParams
+}
+
+func rateLimitFile(ch string) string {
+	return filepath.Join(conf.ChannelDir, encode(ch)+".rate")
+}
+
+func storeRateLimit(ch string, limit *rateLimit) {
+	name := rateLimitFile(ch)
+
+	logger := logger.Add("method", "storeRateLimit", "file", name,
+		"channel", ch)
+
+	data, err := json.Marshal(limit)
+	if err != nil {
+		logger.Fatal("failed to marshal rate limit: " + err.Error())
+	}
+
+	if err := ioutil.WriteFile(name, data, chanPerm); err != nil {
+		logger.Fatal("failed to store rate limit: " + err.Error())
+	}
+}
+
+func loadRateLimit(ch string) *rateLimit {
+	name := rateLimitFile(ch)
+
+	logger := logger.Add("method", "loadRateLimit", "file", name,
+		"channel", ch)
+
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			logger.Fatal("no connected client for channel")
+		}
+		logger.Fatal("failed to load rate limit: " + err.Error())
+	}
+
+	var limit rateLimit
+	if err := json.Unmarshal(data, &limit); err != nil {
+		logger.Fatal("failed to unmarshal rate limit: " + err.Error())
+	}
+	return &limit
+}
+
+func removeRateLimit(ch string) {
+	name := rateLimitFile(ch)
+
+	logger := logger.Add("method", "removeRateLimit", "file", name,
+		"channel", ch)
+
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		logger.Error("failed to remove rate limit: " + err.Error())
+	}
+}
+
+// handleRateLimit changes a rate limit of a connected client without
+// reconnecting it. Given params are merged into the current ones, so
+// {"maxDownloadMbits": 1} throttles the client, keeping other params.
+func handleRateLimit(ch, params string) {
+	logger := logger.Add("method", "handleRateLimit", "channel", ch,
+		"params", params)
+
+	limit := loadRateLimit(ch)
+
+	if err := limit.Params.Merge([]byte(params)); err != nil {
+		logger.Fatal("bad rate limit params: " + err.Error())
+	}
+
+	up, down, err := tc.Profiles(&limit.Params)
+	if err != nil {
+		logger.Fatal("bad rate limit params: " + err.Error())
+	}
+
+	err = tctrl.UpdateRateLimit(limit.Iface, limit.ClientIP, up, down)
+	if err != nil {
+		logger.Fatal("failed to update rate limit: " + err.Error())
+	}
+
+	storeRateLimit(ch, limit)
+	logger.Info("rate limit updated")
+}
@@ -0,0 +1,116 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const keyLen = 32 // AES-256.
+
+// encryptedStore keeps each secret in a file encrypted with AES-GCM.
+type encryptedStore struct {
+	files   *fileStore
+	keyFile string
+}
+
+func newEncryptedStore(dir, keyFile string) *encryptedStore {
+	return &encryptedStore{files: newFileStore(dir), keyFile: keyFile}
+}
+
+// aead returns a cipher with the store key. The key is generated, if it
+// does not exist.
+func (s *encryptedStore) aead() (cipher.AEAD, error) {
+	data, err := ioutil.ReadFile(s.keyFile)
+	if os.IsNotExist(err) {
+		key := make([]byte, keyLen)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, err
+		}
+		data = []byte(hex.EncodeToString(key))
+		err = writeFile(s.keyFile, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Stat(s.keyFile); err == nil {
+		if err := harden(s.keyFile, info); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != keyLen {
+		return nil, ErrBadKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Get returns a decrypted secret.
+func (s *encryptedStore) Get(name string) (string, error) {
+	data, err := s.files.read(name)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(
+		strings.TrimSpace(string(data)))
+	if err != nil {
+		return "", ErrDecrypt
+	}
+
+	aead, err := s.aead()
+	if err != nil {
+		return "", err
+	}
+
+	size := aead.NonceSize()
+	if len(sealed) < size {
+		return "", ErrDecrypt
+	}
+
+	// A name is authenticated, so secrets can not be swapped.
+	value, err := aead.Open(nil, sealed[:size], sealed[size:], []byte(name))
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	return string(value), nil
+}
+
+// Set encrypts and saves a secret.
+func (s *encryptedStore) Set(name, value string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+
+	aead, err := s.aead()
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	return s.files.write(name,
+		[]byte(base64.StdEncoding.EncodeToString(sealed)))
+}
+
+// Delete removes a secret.
+func (s *encryptedStore) Delete(name string) error {
+	return s.files.Delete(name)
+}
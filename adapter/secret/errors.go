@@ -0,0 +1,25 @@
+package secret
+
+import "github.com/privatix/dappctrl/util/errors"
+
+// Errors.
+const (
+	// CRC16("github.com/privatix/dapp-openvpn/adapter/secret") = 0x69DD
+	ErrUnknownStore errors.Error = 0x69DD<<8 + iota
+	ErrNotFound
+	ErrBadName
+	ErrBadKey
+	ErrDecrypt
+	ErrKeyringNotSupported
+)
+
+var errMsgs = errors.Messages{
+	ErrUnknownStore:        "unknown secret store",
+	ErrNotFound:            "secret not found",
+	ErrBadName:             "bad secret name",
+	ErrBadKey:              "bad secret store key",
+	ErrDecrypt:             "failed to decrypt secret",
+	ErrKeyringNotSupported: "keyring is not supported on this platform",
+}
+
+func init() { errors.InjectMessages(errMsgs) }
@@ -0,0 +1,124 @@
+package secret
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	dirPerm  = 0700
+	filePerm = 0600
+)
+
+// fileStore keeps each secret in a file readable by owner only.
+type fileStore struct {
+	dir string
+}
+
+func newFileStore(dir string) *fileStore {
+	return &fileStore{dir: dir}
+}
+
+func (s *fileStore) file(name string) (string, error) {
+	if err := checkName(name); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, name), nil
+}
+
+// Get returns a secret. Permissions of a secret file readable by others
+// are restricted.
+func (s *fileStore) Get(name string) (string, error) {
+	data, err := s.read(name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func (s *fileStore) read(name string) ([]byte, error) {
+	file, err := s.file(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(file)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := harden(file, info); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(file)
+}
+
+// Set saves a secret.
+func (s *fileStore) Set(name, value string) error {
+	return s.write(name, []byte(value))
+}
+
+func (s *fileStore) write(name string, data []byte) error {
+	file, err := s.file(name)
+	if err != nil {
+		return err
+	}
+	return writeFile(file, data)
+}
+
+// Delete removes a secret.
+func (s *fileStore) Delete(name string) error {
+	file, err := s.file(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// writeFile atomically writes a file readable by owner only.
+func writeFile(file string, data []byte) error {
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, ".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Chmod(filePerm); err != nil && runtime.GOOS != "windows" {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// harden restricts permissions of a file readable by others. Windows
+// files are protected by ACLs of their directories.
+func harden(file string, info os.FileInfo) error {
+	if runtime.GOOS == "windows" || info.Mode().Perm()&0077 == 0 {
+		return nil
+	}
+	return os.Chmod(file, filePerm)
+}
@@ -0,0 +1,54 @@
+package secret
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// keyringStore keeps secrets in a macOS keychain.
+type keyringStore struct {
+	service string
+}
+
+func newKeyringStore(service string) *keyringStore {
+	return &keyringStore{service: service}
+}
+
+// Get returns a secret.
+func (s *keyringStore) Get(name string) (string, error) {
+	if err := checkName(name); err != nil {
+		return "", err
+	}
+
+	out, err := exec.Command("/usr/bin/security", "find-generic-password",
+		"-s", s.service, "-a", name, "-w").Output()
+	if err != nil {
+		return "", ErrNotFound
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+// Set saves a secret. security takes a password from the command line
+// only, unless it's run in a terminal.
+func (s *keyringStore) Set(name, value string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+
+	return exec.Command("/usr/bin/security", "add-generic-password", "-U",
+		"-s", s.service, "-a", name, "-w", value).Run()
+}
+
+// Delete removes a secret.
+func (s *keyringStore) Delete(name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+
+	err := exec.Command("/usr/bin/security", "delete-generic-password",
+		"-s", s.service, "-a", name).Run()
+	if _, err := s.Get(name); err == ErrNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,58 @@
+package secret
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+)
+
+// keyringStore keeps secrets in a Secret Service keyring with secret-tool.
+type keyringStore struct {
+	service string
+}
+
+func newKeyringStore(service string) *keyringStore {
+	return &keyringStore{service: service}
+}
+
+func (s *keyringStore) attrs(name string) []string {
+	return []string{"service", s.service, "account", name}
+}
+
+// Get returns a secret.
+func (s *keyringStore) Get(name string) (string, error) {
+	if err := checkName(name); err != nil {
+		return "", err
+	}
+
+	out, err := exec.Command("secret-tool",
+		append([]string{"lookup"}, s.attrs(name)...)...).Output()
+	if err != nil || len(out) == 0 {
+		return "", ErrNotFound
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+// Set saves a secret. The secret is passed through stdin, so it's not
+// seen in a process list.
+func (s *keyringStore) Set(name, value string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+
+	args := append([]string{"store", "--label", s.service + " " + name},
+		s.attrs(name)...)
+	cmd := exec.Command("secret-tool", args...)
+	cmd.Stdin = bytes.NewBufferString(value)
+	return cmd.Run()
+}
+
+// Delete removes a secret.
+func (s *keyringStore) Delete(name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+
+	return exec.Command("secret-tool",
+		append([]string{"clear"}, s.attrs(name)...)...).Run()
+}
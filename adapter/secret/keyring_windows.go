@@ -0,0 +1,23 @@
+package secret
+
+// keyringStore is not supported on Windows, use the encrypted store.
+type keyringStore struct{}
+
+func newKeyringStore(service string) *keyringStore {
+	return &keyringStore{}
+}
+
+// Get returns ErrKeyringNotSupported.
+func (s *keyringStore) Get(name string) (string, error) {
+	return "", ErrKeyringNotSupported
+}
+
+// Set returns ErrKeyringNotSupported.
+func (s *keyringStore) Set(name, value string) error {
+	return ErrKeyringNotSupported
+}
+
+// Delete returns ErrKeyringNotSupported.
+func (s *keyringStore) Delete(name string) error {
+	return ErrKeyringNotSupported
+}
@@ -0,0 +1,92 @@
+// Package secret keeps passwords out of configuration files.
+package secret
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Kinds of secret stores.
+const (
+	StoreFile      = "file"      // A file per secret readable by owner.
+	StoreEncrypted = "encrypted" // Files encrypted with a key file.
+	StoreKeyring   = "keyring"   // OS keyring.
+)
+
+// RefPrefix marks a configuration value, which is a name of a secret.
+const RefPrefix = "secret:"
+
+// Config is a configuration of a secret store.
+type Config struct {
+	Store   string // file, encrypted or keyring.
+	Dir     string // Directory for file and encrypted stores.
+	KeyFile string // Key of encrypted store, created when missing.
+	Service string // Keyring service name.
+}
+
+// NewConfig creates a default secret store configuration.
+func NewConfig() *Config {
+	return &Config{
+		Store:   StoreFile,
+		Dir:     "secrets",
+		KeyFile: "secrets/.key",
+		Service: "dappvpn",
+	}
+}
+
+// Store keeps secrets by names.
+type Store interface {
+	Get(name string) (string, error)
+	Set(name, value string) error
+	Delete(name string) error
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func checkName(name string) error {
+	if !validName.MatchString(name) {
+		return ErrBadName
+	}
+	return nil
+}
+
+// New creates a secret store. Relative paths of the configuration are
+// relative to a given directory.
+func New(conf *Config, dir string) (Store, error) {
+	abs := func(path string) string {
+		if filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+
+	switch conf.Store {
+	case StoreFile:
+		return newFileStore(abs(conf.Dir)), nil
+	case StoreEncrypted:
+		return newEncryptedStore(abs(conf.Dir), abs(conf.KeyFile)), nil
+	case StoreKeyring:
+		return newKeyringStore(conf.Service), nil
+	}
+	return nil, ErrUnknownStore
+}
+
+// Ref returns a configuration value referencing a secret.
+func Ref(name string) string {
+	return RefPrefix + name
+}
+
+// IsRef tells whether a configuration value references a secret.
+func IsRef(value string) bool {
+	return strings.HasPrefix(value, RefPrefix)
+}
+
+// Resolve returns a referenced secret or the value itself, if it's not
+// a reference.
+func Resolve(s Store, value string) (string, error) {
+	if !IsRef(value) {
+		return value, nil
+	}
+	return s.Get(strings.TrimPrefix(value, RefPrefix))
+}
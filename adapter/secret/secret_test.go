@@ -0,0 +1,105 @@
+// +build !nosecrettest
+
+package secret
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func testStore(t *testing.T, store string) {
+	dir, err := ioutil.TempDir("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := NewConfig()
+	conf.Store = store
+
+	s, err := New(conf, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Get("password"); err != ErrNotFound {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+
+	if err := s.Set("../password", "secret"); err != ErrBadName {
+		t.Fatalf("expected bad name error, got %v", err)
+	}
+
+	if err := s.Set("password", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, conf.Dir, "password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store == StoreEncrypted && string(data) == "secret" {
+		t.Fatal("secret is not encrypted")
+	}
+
+	value, err := Resolve(s, Ref("password"))
+	if err != nil || value != "secret" {
+		t.Fatalf("unexpected secret: %s, %v", value, err)
+	}
+
+	if err := s.Delete("password"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Get("password"); err != ErrNotFound {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	testStore(t, StoreFile)
+}
+
+func TestEncryptedStore(t *testing.T) {
+	testStore(t, StoreEncrypted)
+}
+
+func TestHarden(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are not used on windows")
+	}
+
+	dir, err := ioutil.TempDir("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "password")
+	if err := ioutil.WriteFile(file, []byte("secret\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := newFileStore(dir).Get("password")
+	if err != nil || value != "secret" {
+		t.Fatalf("unexpected secret: %s, %v", value, err)
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != filePerm {
+		t.Fatalf("unexpected permissions: %v", info.Mode())
+	}
+}
+
+func TestResolvePlain(t *testing.T) {
+	value, err := Resolve(nil, "plain")
+	if err != nil || value != "plain" {
+		t.Fatalf("unexpected value: %s, %v", value, err)
+	}
+}
@@ -0,0 +1,27 @@
+package sup
+
+import "github.com/privatix/dappctrl/util/errors"
+
+// Errors.
+const (
+	// CRC16("github.com/privatix/dapp-openvpn/adapter/sup") = 0xC55C
+	ErrStart errors.Error = 0xC55C<<8 + iota
+	ErrReadyTimeout
+	ErrAuthFailed
+	ErrTLS
+	ErrNetworkUnreachable
+	ErrExited
+	ErrTooManyRestarts
+)
+
+var errMsgs = errors.Messages{
+	ErrStart:              "failed to launch openvpn",
+	ErrReadyTimeout:       "openvpn management interface is not ready",
+	ErrAuthFailed:         "openvpn authentication failed",
+	ErrTLS:                "openvpn tls error",
+	ErrNetworkUnreachable: "network is unreachable",
+	ErrExited:             "openvpn exited",
+	ErrTooManyRestarts:    "too many openvpn restarts",
+}
+
+func init() { errors.InjectMessages(errMsgs) }
@@ -0,0 +1,170 @@
+package sup
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/privatix/dappctrl/util/log"
+)
+
+// Severity of an OpenVPN output line.
+const (
+	severityInfo = iota
+	severityWarn
+	severityError
+)
+
+// timestampRegexp matches timestamps OpenVPN prefixes its output with,
+// e.g. "Mon Jan  2 15:04:05 2006 " or "2006-01-02 15:04:05 ".
+var timestampRegexp = regexp.MustCompile(
+	`^(\w{3} \w{3} +\d+ \d{2}:\d{2}:\d{2} \d{4}|` +
+		`\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}) (us=\d+ )?`)
+
+// managementReady is printed when management interface accepts connections.
+const managementReady = "MANAGEMENT: TCP Socket listening"
+
+var exitReasons = []struct {
+	pattern string
+	err     error
+}{
+	{"AUTH_FAILED", ErrAuthFailed},
+	{"TLS Error", ErrTLS},
+	{"TLS handshake failed", ErrTLS},
+	{"Network is unreachable", ErrNetworkUnreachable},
+	{"Network unreachable", ErrNetworkUnreachable},
+}
+
+// parseLine strips a timestamp from an OpenVPN output line and finds out its
+// severity.
+func parseLine(line string) (int, string) {
+	line = strings.TrimSpace(timestampRegexp.ReplaceAllString(line, ""))
+	upper := strings.ToUpper(line)
+
+	switch {
+	case strings.Contains(upper, "FATAL"),
+		strings.Contains(upper, "ERROR"),
+		strings.Contains(upper, "AUTH_FAILED"):
+		return severityError, line
+	case strings.Contains(upper, "WARNING"):
+		return severityWarn, line
+	}
+	return severityInfo, line
+}
+
+// exitReason finds out a failure reason from an OpenVPN output line.
+func exitReason(line string) error {
+	for _, v := range exitReasons {
+		if strings.Contains(line, v.pattern) {
+			return v.err
+		}
+	}
+	return nil
+}
+
+// output passes OpenVPN output to the logger and remembers the most
+// significant failure reason.
+type output struct {
+	logger    log.Logger
+	mtx       sync.Mutex
+	reason    error
+	ready     chan struct{}
+	readyOnce sync.Once
+}
+
+func newOutput(logger log.Logger) *output {
+	return &output{
+		logger: logger.Add("source", "openvpn"),
+		ready:  make(chan struct{}),
+	}
+}
+
+func (o *output) write(line string) {
+	severity, msg := parseLine(line)
+	if len(msg) == 0 {
+		return
+	}
+
+	switch severity {
+	case severityError:
+		o.logger.Error(msg)
+	case severityWarn:
+		o.logger.Warn(msg)
+	default:
+		o.logger.Info(msg)
+	}
+
+	if strings.Contains(msg, managementReady) {
+		o.readyOnce.Do(func() { close(o.ready) })
+	}
+
+	if err := exitReason(msg); err != nil {
+		o.mtx.Lock()
+		// An authentication failure is final, it is never replaced.
+		if o.reason != ErrAuthFailed {
+			o.reason = err
+		}
+		o.mtx.Unlock()
+	}
+}
+
+func (o *output) exitReason() error {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	return o.reason
+}
+
+const followPeriod = 200 * time.Millisecond
+
+// follow reads lines appended to a file from a given offset until done is
+// closed. The file may not exist yet.
+func follow(name string, offset int64, write func(string),
+	done <-chan struct{}) {
+	var file *os.File
+	var reader *bufio.Reader
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	var partial string
+	for {
+		finished := false
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+
+		if file == nil {
+			if f, err := os.Open(name); err == nil {
+				if _, err := f.Seek(offset, io.SeekStart); err != nil {
+					f.Close()
+				} else {
+					file = f
+					reader = bufio.NewReader(f)
+				}
+			}
+		}
+
+		for reader != nil {
+			line, err := reader.ReadString('\n')
+			partial += line
+			if err != nil {
+				break
+			}
+			write(strings.TrimRight(partial, "\r\n"))
+			partial = ""
+		}
+
+		if finished {
+			return
+		}
+		time.Sleep(followPeriod)
+	}
+}
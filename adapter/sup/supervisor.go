@@ -0,0 +1,278 @@
+package sup
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/privatix/dappctrl/util/log"
+)
+
+// Config is a configuration for OpenVPN supervisor.
+type Config struct {
+	ReadyTimeout    uint // Wait for management interface, in seconds.
+	StopTimeout     uint // Wait for OpenVPN to exit, in seconds.
+	RestartDelay    uint // Initial delay before restart, in milliseconds.
+	MaxRestartDelay uint // In milliseconds.
+	MaxRestarts     uint // Restarts in a row, 0 means unlimited.
+	StablePeriod    uint // Run time to reset restarts counter, in seconds.
+}
+
+// NewConfig creates a default configuration for OpenVPN supervisor.
+func NewConfig() *Config {
+	return &Config{
+		ReadyTimeout:    30,
+		StopTimeout:     10,
+		RestartDelay:    1000,
+		MaxRestartDelay: 60000,
+		MaxRestarts:     10,
+		StablePeriod:    60,
+	}
+}
+
+// ReadyFunc is called when management interface of a launched OpenVPN is
+// ready. The context is cancelled when the OpenVPN process exits or is
+// requested to stop. The supervisor waits for the function to return.
+type ReadyFunc func(ctx context.Context)
+
+// Supervisor launches OpenVPN in client mode and restarts it on transient
+// failures.
+type Supervisor struct {
+	conf    *Config
+	logger  log.Logger
+	name    string
+	args    []string
+	logFile string // OpenVPN log file to follow, if any.
+}
+
+// NewSupervisor creates a new OpenVPN supervisor. When OpenVPN is
+// configured to write a log file, the file is followed instead of
+// the standard output.
+func NewSupervisor(conf *Config, logger log.Logger,
+	name string, args []string, logFile string) *Supervisor {
+	return &Supervisor{
+		conf:    conf,
+		logger:  logger.Add("type", "sup.Supervisor"),
+		name:    name,
+		args:    args,
+		logFile: logFile,
+	}
+}
+
+// permanent checks whether a failure can not be fixed by a restart.
+func permanent(err error) bool {
+	return err == ErrAuthFailed || err == ErrStart
+}
+
+// delay returns an exponential backoff delay for a given restart.
+func (s *Supervisor) delay(restart uint) time.Duration {
+	d := time.Duration(s.conf.RestartDelay) * time.Millisecond
+	max := time.Duration(s.conf.MaxRestartDelay) * time.Millisecond
+
+	for i := uint(1); i < restart && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// Run launches OpenVPN and keeps it running until the context is done.
+// It returns nil when stopped by the context, otherwise a reason of
+// the last failure.
+func (s *Supervisor) Run(ctx context.Context, ready ReadyFunc) error {
+	logger := s.logger.Add("method", "Run")
+
+	var restarts uint
+	for {
+		started := time.Now()
+		err := s.runOnce(ctx, ready)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		if permanent(err) {
+			logger.Error("openvpn failed: " + err.Error())
+			return err
+		}
+
+		if time.Since(started) >=
+			time.Duration(s.conf.StablePeriod)*time.Second {
+			restarts = 0
+		}
+		restarts++
+
+		if s.conf.MaxRestarts != 0 && restarts > s.conf.MaxRestarts {
+			logger.Error(ErrTooManyRestarts.Error())
+			return ErrTooManyRestarts
+		}
+
+		d := s.delay(restarts)
+		logger.Warn(fmt.Sprintf("openvpn failed: %v, restart %d in %v",
+			err, restarts, d))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(d):
+		}
+	}
+}
+
+func (s *Supervisor) runOnce(ctx context.Context, ready ReadyFunc) error {
+	logger := s.logger.Add("method", "runOnce")
+
+	cmd := exec.Command(s.name, s.args...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		logger.Error(err.Error())
+		return ErrStart
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		logger.Error(err.Error())
+		return ErrStart
+	}
+
+	var offset int64
+	if info, err := os.Stat(s.logFile); err == nil {
+		offset = info.Size()
+	}
+
+	if err := cmd.Start(); err != nil {
+		logger.Error(err.Error())
+		return ErrStart
+	}
+
+	out := newOutput(s.logger)
+
+	// Pipes are read concurrently, so that a full buffer of one of them
+	// does not block the process.
+	var reading sync.WaitGroup
+	for _, pipe := range []io.Reader{stdout, stderr} {
+		reading.Add(1)
+		go func(pipe io.Reader) {
+			defer reading.Done()
+			scanner := bufio.NewScanner(pipe)
+			for scanner.Scan() {
+				out.write(scanner.Text())
+			}
+			if err := scanner.Err(); err != nil {
+				logger.Warn("failed to read openvpn output: " +
+					err.Error())
+			}
+		}(pipe)
+	}
+
+	var waitErr error
+	exited := make(chan struct{})
+	go func() {
+		reading.Wait()
+		waitErr = cmd.Wait()
+		close(exited)
+	}()
+
+	// Output is completely processed when both the process has exited
+	// and its log file is read to the end.
+	finished := make(chan struct{})
+	go func() {
+		if len(s.logFile) != 0 {
+			follow(s.logFile, offset, out.write, exited)
+		}
+		<-exited
+		close(finished)
+	}()
+
+	if err := s.waitReady(ctx, out.ready, exited); err != nil {
+		cmd.Process.Kill()
+		<-finished
+		if reason := out.exitReason(); reason != nil {
+			return reason
+		}
+		return err
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	readyDone := make(chan struct{})
+	go func() {
+		ready(runCtx)
+		close(readyDone)
+	}()
+
+	select {
+	case <-finished:
+		cancel()
+		<-readyDone
+	case <-ctx.Done():
+		s.stop(cmd, exited)
+		<-readyDone
+		return nil
+	}
+
+	if reason := out.exitReason(); reason != nil {
+		return reason
+	}
+
+	if waitErr != nil {
+		logger.Warn("openvpn exited: " + waitErr.Error())
+	}
+	return ErrExited
+}
+
+// waitReady waits until OpenVPN management interface accepts connections.
+// The interface is not probed, because OpenVPN exits when a management
+// session disconnects.
+func (s *Supervisor) waitReady(ctx context.Context,
+	ready, exited <-chan struct{}) error {
+	select {
+	case <-ready:
+		return nil
+	case <-exited:
+		return ErrExited
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Duration(s.conf.ReadyTimeout) * time.Second):
+		return ErrReadyTimeout
+	}
+}
+
+// stop waits for OpenVPN to exit. OpenVPN is asked to exit through
+// management interface by the ready function. If it does not exit in time,
+// it is terminated and then killed.
+func (s *Supervisor) stop(cmd *exec.Cmd, exited <-chan struct{}) {
+	timeout := time.Duration(s.conf.StopTimeout) * time.Second
+
+	select {
+	case <-exited:
+		return
+	case <-time.After(timeout):
+	}
+
+	// Signals other than kill are not supported on Windows.
+	if err := cmd.Process.Signal(syscall.SIGTERM); err == nil {
+		s.logger.Warn("openvpn did not exit in time, terminating it")
+		select {
+		case <-exited:
+			return
+		case <-time.After(timeout):
+		}
+	}
+
+	s.logger.Warn("openvpn did not exit in time, killing it")
+	cmd.Process.Kill()
+	<-exited
+}
@@ -0,0 +1,144 @@
+// +build !nosuptest
+
+package sup
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/privatix/dappctrl/util/log"
+)
+
+var logger log.Logger
+
+func newTestSupervisor(script string) *Supervisor {
+	conf := NewConfig()
+	conf.ReadyTimeout = 5
+	conf.StopTimeout = 1
+	conf.RestartDelay = 1
+	conf.MaxRestartDelay = 10
+	conf.MaxRestarts = 2
+	return NewSupervisor(conf, logger, "sh", []string{"-c", script}, "")
+}
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		severity int
+		msg      string
+	}{
+		{"Mon Jan  2 15:04:05 2006 Initialization Sequence Completed",
+			severityInfo, "Initialization Sequence Completed"},
+		{"2006-01-02 15:04:05 WARNING: file is group readable",
+			severityWarn, "WARNING: file is group readable"},
+		{"2006-01-02 15:04:05 us=123 AUTH_FAILED",
+			severityError, "AUTH_FAILED"},
+		{"Options error: unknown option", severityError,
+			"Options error: unknown option"},
+	}
+
+	for _, v := range tests {
+		severity, msg := parseLine(v.line)
+		if severity != v.severity || msg != v.msg {
+			t.Errorf("wrong parsing of %q: %d, %q", v.line, severity, msg)
+		}
+	}
+}
+
+func TestExitReason(t *testing.T) {
+	tests := map[string]error{
+		"AUTH: Received control message: AUTH_FAILED":    ErrAuthFailed,
+		"TLS Error: TLS key negotiation failed to occur": ErrTLS,
+		"TCP: connect to [AF_INET]1.2.3.4:443 failed: " +
+			"Network is unreachable": ErrNetworkUnreachable,
+		"Initialization Sequence Completed": nil,
+	}
+
+	for line, expected := range tests {
+		if err := exitReason(line); err != expected {
+			t.Errorf("wrong exit reason of %q: %v", line, err)
+		}
+	}
+}
+
+func TestDelay(t *testing.T) {
+	s := newTestSupervisor("")
+	s.conf.RestartDelay = 100
+	s.conf.MaxRestartDelay = 500
+
+	expected := []time.Duration{100, 200, 400, 500, 500}
+	for i, v := range expected {
+		if d := s.delay(uint(i + 1)); d != v*time.Millisecond {
+			t.Errorf("wrong delay of restart %d: %v", i+1, d)
+		}
+	}
+}
+
+func TestRunAuthFailed(t *testing.T) {
+	s := newTestSupervisor("echo '" + managementReady + "'; " +
+		"sleep 0.2; echo AUTH_FAILED; exit 1")
+
+	ready := make(chan struct{}, 1)
+	err := s.Run(context.Background(), func(ctx context.Context) {
+		ready <- struct{}{}
+	})
+	if err != ErrAuthFailed {
+		t.Fatalf("expected %v, got %v", ErrAuthFailed, err)
+	}
+
+	select {
+	case <-ready:
+	default:
+		t.Fatal("ready function was not called")
+	}
+}
+
+func TestRunTooManyRestarts(t *testing.T) {
+	s := newTestSupervisor("echo 'TLS Error: handshake'; exit 1")
+
+	err := s.Run(context.Background(), func(ctx context.Context) {
+		t.Error("ready function must not be called")
+	})
+	if err != ErrTooManyRestarts {
+		t.Fatalf("expected %v, got %v", ErrTooManyRestarts, err)
+	}
+}
+
+func TestRunStop(t *testing.T) {
+	s := newTestSupervisor("echo '" + managementReady + "'; exec sleep 30")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ready := make(chan struct{})
+
+	ret := make(chan error)
+	go func() {
+		ret <- s.Run(ctx, func(ctx context.Context) {
+			close(ready)
+			<-ctx.Done()
+		})
+	}()
+
+	select {
+	case <-ready:
+	case <-time.After(5 * time.Second):
+		t.Fatal("openvpn is not ready")
+	}
+	cancel()
+
+	select {
+	case err := <-ret:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("openvpn is not stopped")
+	}
+}
+
+func TestMain(m *testing.M) {
+	logger = log.NewMultiLogger()
+
+	os.Exit(m.Run())
+}
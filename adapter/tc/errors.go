@@ -6,10 +6,16 @@ import "github.com/privatix/dappctrl/util/errors"
 const (
 	// CRC16("github.com/privatix/dapp-openvpn/adapter/tc") = 0x63FE
 	ErrBadClientIP errors.Error = 0x63FE<<8 + iota
+	ErrClientIPNotInSubnet
+	ErrBadPriority
+	ErrNoEgressInterface
 )
 
 var errMsgs = errors.Messages{
-	ErrBadClientIP: "bad client IP",
+	ErrBadClientIP:         "bad client IP",
+	ErrClientIPNotInSubnet: "client IP is not in the tunnel subnet",
+	ErrBadPriority:         "bad priority class",
+	ErrNoEgressInterface:   "no default route to find egress interface",
 }
 
 func init() { errors.InjectMessages(errMsgs) }
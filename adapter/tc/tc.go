@@ -6,8 +6,62 @@ import (
 	"strings"
 
 	"github.com/privatix/dappctrl/util/log"
+
+	"github.com/privatix/dapp-openvpn/adapter/data"
 )
 
+// Profile is a bandwidth profile in one direction.
+type Profile struct {
+	// RateMbits is a guaranteed rate, a small one with a ceiling only.
+	// A profile with neither a rate nor a ceiling does not limit.
+	RateMbits   float32
+	CeilMbits   float32 // Ceiling, the uplink when zero.
+	BurstKbytes uint32  // Burst size, the tc default when zero.
+	Priority    uint8   // HTB priority, 0 is the highest.
+}
+
+// priorities maps priority classes to HTB priorities.
+var priorities = map[string]uint8{
+	data.PriorityHigh:   1,
+	data.PriorityNormal: 3,
+	data.PriorityLow:    5,
+}
+
+// Priority returns an HTB priority for a given priority class.
+func Priority(class string) (uint8, error) {
+	if len(class) == 0 {
+		return priorities[data.PriorityNormal], nil
+	}
+
+	prio, ok := priorities[strings.ToLower(class)]
+	if !ok {
+		return 0, ErrBadPriority
+	}
+	return prio, nil
+}
+
+// Profiles returns upload and download bandwidth profiles of an offering.
+func Profiles(params *data.OfferingParams) (up, down *Profile, err error) {
+	prio, err := Priority(params.Priority)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	up = &Profile{
+		RateMbits:   params.MinUploadMbits,
+		CeilMbits:   params.MaxUploadMbits,
+		BurstKbytes: params.BurstKbytes,
+		Priority:    prio,
+	}
+	down = &Profile{
+		RateMbits:   params.MinDownloadMbits,
+		CeilMbits:   params.MaxDownloadMbits,
+		BurstKbytes: params.BurstKbytes,
+		Priority:    prio,
+	}
+	return up, down, nil
+}
+
 // TrafficControl is a traffic control utility.
 type TrafficControl struct {
 	conf   *Config
@@ -1,16 +1,24 @@
 package tc
 
 import (
+	"bufio"
 	"fmt"
 	"hash/crc32"
 	"net"
+	"os"
+	"strconv"
 	"strings"
+
+	"github.com/privatix/dappctrl/util/log"
 )
 
 // Config is a traffic control configuration.
 type Config struct {
 	TcPath       string
 	IptablesPath string
+	Subnet       string  // Tunnel subnet in CIDR notation, if known.
+	UplinkMbits  float32 // Bandwidth shared between clients.
+	Egress       string  // Upload interface, default route's if empty.
 }
 
 // NewConfig creates a default configuration.
@@ -18,23 +26,240 @@ func NewConfig() *Config {
 	return &Config{
 		TcPath:       "/sbin/tc",
 		IptablesPath: "/sbin/iptables",
+		UplinkMbits:  defaultUplinkMbits,
 	}
 }
 
+const (
+	defaultUplinkMbits = 1000
+
+	// defaultRateMbits is a guaranteed rate of a profile with a ceiling
+	// only.
+	defaultRateMbits = 0.1
+
+	routeFile = "/proc/net/route"
+)
+
+// rootClassID is a class sized to the uplink, client classes borrow idle
+// bandwidth from it.
+const rootClassID = "1:1"
+
 // See http://tldp.org/HOWTO/Traffic-Control-HOWTO/ as reference.
 
-// SetRateLimit sets a rate limit for a given client IP address on a given
-// network interface.
+// SetRateLimit sets a rate limit for a given client IP address. Download is
+// shaped on a given tunnel interface, upload on the egress interface.
 func (tc *TrafficControl) SetRateLimit(
-	iface, clientIP string, upMbps, downMbps float32) error {
+	iface, clientIP string, up, down *Profile) error {
 	logger := tc.logger.Add("method", "SetRateLimit", "iface", iface,
-		"clientIp", clientIP, "up", upMbps, "down", downMbps)
+		"clientIp", clientIP, "up", up, "down", down)
 
 	ip := net.ParseIP(clientIP)
 	if ip == nil {
 		return ErrBadClientIP
 	}
 
+	if !tc.inSubnet(ip) {
+		return ErrClientIPNotInSubnet
+	}
+
+	if limited(down) {
+		err := tc.setClass(logger, download(iface, ip), ip, down)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !limited(up) {
+		return nil
+	}
+
+	dir, err := tc.upload(ip)
+	if err != nil {
+		return err
+	}
+	return tc.setClass(logger, dir, ip, up)
+}
+
+// UpdateRateLimit changes a rate limit of a connected client in place. A rate
+// limit is set when the client has none and removed when a profile does not
+// limit bandwidth any more.
+func (tc *TrafficControl) UpdateRateLimit(
+	iface, clientIP string, up, down *Profile) error {
+	logger := tc.logger.Add("method", "UpdateRateLimit", "iface", iface,
+		"clientIp", clientIP, "up", up, "down", down)
+
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return ErrBadClientIP
+	}
+
+	if !tc.inSubnet(ip) {
+		return ErrClientIPNotInSubnet
+	}
+
+	err := tc.updateClass(logger, download(iface, ip), ip, down)
+	if err != nil {
+		return err
+	}
+
+	dir, err := tc.upload(ip)
+	if err != nil {
+		return err
+	}
+	return tc.updateClass(logger, dir, ip, up)
+}
+
+// direction is traffic of a client in one direction. It's shaped when it
+// leaves an interface.
+type direction struct {
+	iface string
+	match []string // iptables match of the client traffic.
+}
+
+func download(iface string, ip net.IP) direction {
+	return direction{iface, []string{"-o", iface, "-d", ip.String()}}
+}
+
+// upload returns client traffic leaving the egress interface. It's matched
+// in mangle POSTROUTING, which is before the source address is masqueraded.
+func (tc *TrafficControl) upload(ip net.IP) (direction, error) {
+	egress, err := tc.egress()
+	if err != nil {
+		return direction{}, err
+	}
+	return direction{egress, []string{"-o", egress, "-s", ip.String()}},
+		nil
+}
+
+// limited checks whether a profile limits bandwidth.
+func limited(p *Profile) bool {
+	return p != nil && (p.RateMbits > 0 || p.CeilMbits > 0)
+}
+
+// setClass adds a client class and classifies client traffic into it.
+func (tc *TrafficControl) setClass(logger log.Logger, dir direction,
+	ip net.IP, p *Profile) error {
+	if err := tc.setRoot(logger, dir.iface); err != nil {
+		return err
+	}
+
+	cid := classID(ip)
+	_, err := tc.run(logger, tc.conf.TcPath, append([]string{
+		"class", "replace", "dev", dir.iface, "parent", rootClassID,
+		"classid", cid, "htb"}, tc.htbParams(p)...)...)
+	if err != nil {
+		return err
+	}
+
+	_, err = tc.run(logger, tc.conf.IptablesPath, tc.classify("-A",
+		dir, cid)...)
+	return err
+}
+
+// updateClass sets, changes or removes a client class for a new profile.
+func (tc *TrafficControl) updateClass(logger log.Logger, dir direction,
+	ip net.IP, p *Profile) error {
+	exists, err := tc.hasClass(logger, dir.iface, classID(ip))
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !exists && !limited(p):
+		return nil
+	case !exists:
+		return tc.setClass(logger, dir, ip, p)
+	case !limited(p):
+		return tc.unsetClass(logger, dir, ip)
+	}
+
+	_, err = tc.run(logger, tc.conf.TcPath, append([]string{
+		"class", "change", "dev", dir.iface, "parent", rootClassID,
+		"classid", classID(ip), "htb"}, tc.htbParams(p)...)...)
+	return err
+}
+
+// unsetClass removes a client class, if there is one.
+func (tc *TrafficControl) unsetClass(logger log.Logger, dir direction,
+	ip net.IP) error {
+	cid := classID(ip)
+	exists, err := tc.hasClass(logger, dir.iface, cid)
+	if err != nil || !exists {
+		return err
+	}
+
+	_, err = tc.run(logger, tc.conf.IptablesPath, tc.classify("-D",
+		dir, cid)...)
+	if err != nil {
+		return err
+	}
+
+	_, err = tc.run(logger, tc.conf.TcPath,
+		"class", "del", "dev", dir.iface, "classid", cid)
+	return err
+}
+
+func (tc *TrafficControl) hasClass(logger log.Logger,
+	iface, cid string) (bool, error) {
+	out, err := tc.run(logger, tc.conf.TcPath,
+		"class", "show", "dev", iface, "classid", cid)
+	return len(strings.TrimSpace(out)) != 0, err
+}
+
+// classify returns iptables arguments to add or delete a rule, which puts
+// client traffic into a class.
+func (tc *TrafficControl) classify(action string, dir direction,
+	cid string) []string {
+	args := append([]string{"-t", "mangle", action, "POSTROUTING"},
+		dir.match...)
+	return append(args, "-j", "CLASSIFY", "--set-class", cid)
+}
+
+// egress returns a configured egress interface or an interface of the
+// default route with the lowest metric.
+func (tc *TrafficControl) egress() (string, error) {
+	if len(tc.conf.Egress) != 0 {
+		return tc.conf.Egress, nil
+	}
+
+	file, err := os.Open(routeFile)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var iface string
+	var metric uint64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[1] != "00000000" ||
+			fields[7] != "00000000" {
+			continue
+		}
+
+		m, err := strconv.ParseUint(fields[6], 10, 32)
+		if err != nil {
+			continue
+		}
+
+		if len(iface) == 0 || m < metric {
+			iface, metric = fields[0], m
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	if len(iface) == 0 {
+		return "", ErrNoEgressInterface
+	}
+	return iface, nil
+}
+
+// setRoot sets a root htb discipline with a class sized to the uplink.
+func (tc *TrafficControl) setRoot(logger log.Logger, iface string) error {
 	out, err := tc.run(logger, tc.conf.TcPath,
 		"-s", "-d", "qdisc", "show", "dev", iface)
 	if err != nil {
@@ -50,30 +275,56 @@ func (tc *TrafficControl) SetRateLimit(
 		}
 	}
 
-	if downMbps > 0 {
-		cid := classID(ip)
-		rate := fmt.Sprintf("%fMbit", downMbps)
-		_, err = tc.run(logger, tc.conf.TcPath,
-			"class", "add", "dev", iface, "parent", "1:",
-			"classid", cid, "htb", "rate", rate, "ceil", rate)
-		if err != nil {
-			return err
-		}
+	uplink := mbit(tc.uplink())
+	_, err = tc.run(logger, tc.conf.TcPath, "class", "replace",
+		"dev", iface, "parent", "1:", "classid", rootClassID,
+		"htb", "rate", uplink, "ceil", uplink)
+	return err
+}
+
+// htbParams returns htb class parameters for a given profile. Rate and
+// ceiling do not exceed the uplink, a rate is lowered to a lower ceiling.
+func (tc *TrafficControl) htbParams(p *Profile) []string {
+	uplink := tc.uplink()
+
+	rate := p.RateMbits
+	if rate == 0 {
+		rate = defaultRateMbits
+	}
+	if rate > uplink {
+		rate = uplink
+	}
+
+	ceil := p.CeilMbits
+	if ceil == 0 || ceil > uplink {
+		ceil = uplink
+	}
+	if rate > ceil {
+		rate = ceil
+	}
 
-		_, err = tc.run(logger, tc.conf.IptablesPath,
-			"-t", "mangle", "-A", "POSTROUTING", "-o", iface, "-d",
-			ip.String(), "-j", "CLASSIFY", "--set-class", cid)
+	params := []string{"rate", mbit(rate), "ceil", mbit(ceil),
+		"prio", strconv.Itoa(int(p.Priority))}
+	if p.BurstKbytes > 0 {
+		burst := fmt.Sprintf("%dkb", p.BurstKbytes)
+		params = append(params, "burst", burst, "cburst", burst)
 	}
+	return params
+}
 
-	if upMbps > 0 {
-		// TODO: Implement upload rate limiting.
+func (tc *TrafficControl) uplink() float32 {
+	if tc.conf.UplinkMbits <= 0 {
+		return defaultUplinkMbits
 	}
+	return tc.conf.UplinkMbits
+}
 
-	return err
+func mbit(v float32) string {
+	return fmt.Sprintf("%fMbit", v)
 }
 
 // UnsetRateLimit removes a rate limit for a given client IP address on a given
-// network interface.
+// network interface and on the egress interface.
 func (tc *TrafficControl) UnsetRateLimit(iface, clientIP string) error {
 	logger := tc.logger.Add("method", "UnsetRateLimit",
 		"iface", iface, "clientIp", clientIP)
@@ -83,23 +334,32 @@ func (tc *TrafficControl) UnsetRateLimit(iface, clientIP string) error {
 		return ErrBadClientIP
 	}
 
-	cid := classID(ip)
-	_, err := tc.run(logger, tc.conf.IptablesPath,
-		"-t", "mangle", "-D", "POSTROUTING", "-o", iface,
-		"-d", ip.String(), "-j", "CLASSIFY", "--set-class", cid)
-	if err != nil {
+	if err := tc.unsetClass(logger, download(iface, ip), ip); err != nil {
 		return err
 	}
 
-	_, err = tc.run(logger, tc.conf.TcPath,
-		"qdisc", "del", "dev", iface, "root", "handle", cid, "htb")
+	dir, err := tc.upload(ip)
 	if err != nil {
 		return err
 	}
+	return tc.unsetClass(logger, dir, ip)
+}
 
-	return nil
+// inSubnet checks that a client IP address belongs to the tunnel subnet.
+func (tc *TrafficControl) inSubnet(ip net.IP) bool {
+	if len(tc.conf.Subnet) == 0 {
+		return true
+	}
+
+	_, subnet, err := net.ParseCIDR(tc.conf.Subnet)
+	return err == nil && subnet.Contains(ip)
 }
 
+// classID returns a class of a client, which never matches the root class.
 func classID(ip net.IP) string {
-	return fmt.Sprintf("1:%x", uint16(crc32.ChecksumIEEE(ip)))
+	id := uint16(crc32.ChecksumIEEE(ip))
+	if id <= 1 {
+		id += 2
+	}
+	return fmt.Sprintf("1:%x", id)
 }
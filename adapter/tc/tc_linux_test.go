@@ -0,0 +1,64 @@
+// +build !notctest
+
+package tc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/privatix/dapp-openvpn/adapter/data"
+)
+
+func newTestTC() *TrafficControl {
+	return &TrafficControl{conf: &Config{UplinkMbits: 100}}
+}
+
+func TestHTBParams(t *testing.T) {
+	tests := []struct {
+		profile  Profile
+		expected []string
+	}{
+		{Profile{RateMbits: 10, CeilMbits: 20, Priority: 3},
+			[]string{"rate", mbit(10), "ceil", mbit(20), "prio", "3"}},
+		{Profile{RateMbits: 10, Priority: 3},
+			[]string{"rate", mbit(10), "ceil", mbit(100), "prio", "3"}},
+		{Profile{CeilMbits: 5, Priority: 3},
+			[]string{"rate", mbit(0.1), "ceil", mbit(5), "prio", "3"}},
+		{Profile{RateMbits: 10, CeilMbits: 1, Priority: 3},
+			[]string{"rate", mbit(1), "ceil", mbit(1), "prio", "3"}},
+		{Profile{RateMbits: 200, BurstKbytes: 64, Priority: 1},
+			[]string{"rate", mbit(100), "ceil", mbit(100), "prio", "1",
+				"burst", "64kb", "cburst", "64kb"}},
+	}
+
+	for _, v := range tests {
+		params := newTestTC().htbParams(&v.profile)
+		if !reflect.DeepEqual(params, v.expected) {
+			t.Errorf("wrong htb params of %+v: %v",
+				v.profile, params)
+		}
+	}
+}
+
+func TestThrottleProfile(t *testing.T) {
+	params := data.OfferingParams{MinDownloadMbits: 10, MinUploadMbits: 2}
+	if err := params.Merge([]byte(`{"maxDownloadMbits": 1}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	up, down, err := Profiles(&params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc := newTestTC()
+	expected := []string{"rate", mbit(1), "ceil", mbit(1), "prio", "3"}
+	if p := tc.htbParams(down); !reflect.DeepEqual(p, expected) {
+		t.Errorf("throttled download is not limited to 1 Mbit: %v", p)
+	}
+
+	expected = []string{"rate", mbit(2), "ceil", mbit(100), "prio", "3"}
+	if p := tc.htbParams(up); !reflect.DeepEqual(p, expected) {
+		t.Errorf("wrong upload params: %v", p)
+	}
+}
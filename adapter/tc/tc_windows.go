@@ -12,7 +12,13 @@ func NewConfig() *Config {
 // SetRateLimit sets a rate limit for a given client IP address on a given
 // network interface.
 func (tc *TrafficControl) SetRateLimit(
-	iface, clientIP string, upMbps, downMbps float32) error {
+	iface, clientIP string, up, down *Profile) error {
+	return nil
+}
+
+// UpdateRateLimit changes a rate limit of a connected client in place.
+func (tc *TrafficControl) UpdateRateLimit(
+	iface, clientIP string, up, down *Profile) error {
 	return nil
 }
 
@@ -13,6 +13,7 @@ require (
 	github.com/sethvargo/go-password v0.1.2
 	github.com/syndtr/goleveldb v1.0.0 // indirect
 	github.com/takama/daemon v0.0.0-20180403113744-aa76b0035d12
+	github.com/xeipuuv/gojsonschema v1.1.0
 	golang.org/x/text v0.3.1-0.20180807135948-17ff2d5776d2
 	gopkg.in/reform.v1 v1.3.3
 )
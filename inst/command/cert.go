@@ -0,0 +1,99 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/privatix/dapp-openvpn/inst/openvpn"
+	"github.com/privatix/dapp-openvpn/inst/pipeline"
+)
+
+func certFlow(args []string) pipeline.Flow {
+	if len(args) == 0 {
+		return nil
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "status":
+		return pipeline.Flow{
+			newOperator("processed flags", processedCertFlags, nil),
+			newOperator("validate", checkInstallation, nil),
+			newOperator("print status", printCertStatus, nil),
+		}
+	case "renew":
+		return pipeline.Flow{
+			newOperator("processed flags", processedCertFlags, nil),
+			newOperator("validate", checkInstallation, nil),
+			newOperator("renew certificate", renewCertificate, nil),
+			newOperator("stop service", stopService, nil),
+			newOperator("start service", startService, nil),
+		}
+	case "rotate-ca":
+		return pipeline.Flow{
+			newOperator("processed flags", processedCertFlags, nil),
+			newOperator("validate", checkInstallation, nil),
+			newOperator("rotate ca", rotateCA, nil),
+			newOperator("stop service", stopService, nil),
+			newOperator("start service", startService, nil),
+		}
+	}
+	return nil
+}
+
+func processedCertFlags(ovpn *openvpn.OpenVPN) error {
+	h := flag.Bool("help", false, "Display installer help")
+	p := flag.String("workdir", "..", "Product install directory")
+
+	if len(os.Args) > 3 {
+		flag.CommandLine.Parse(os.Args[3:])
+	}
+
+	if *h {
+		fmt.Print(certHelp)
+		os.Exit(0)
+	}
+
+	ovpn.Path = *p
+	return nil
+}
+
+func printCertStatus(o *openvpn.OpenVPN) error {
+	certs, err := o.Certificates()
+	if err != nil {
+		return fmt.Errorf("failed to read certificates: %v", err)
+	}
+
+	now := time.Now()
+	for _, c := range certs {
+		days := int(c.NotAfter.Sub(now).Hours() / 24)
+		fmt.Printf("%s\n", c.File)
+		fmt.Printf("  subject:    %s\n", c.Subject)
+		fmt.Printf("  issuer:     %s\n", c.Issuer)
+		fmt.Printf("  serial:     %s\n", c.Serial)
+		fmt.Printf("  ca:         %v\n", c.IsCA)
+		fmt.Printf("  not before: %s\n", c.NotBefore.Format(time.RFC3339))
+		fmt.Printf("  not after:  %s (%d days left)\n",
+			c.NotAfter.Format(time.RFC3339), days)
+		fmt.Printf("  sha1:       %s\n", c.SHA1)
+		fmt.Printf("  sha256:     %s\n", c.SHA256)
+	}
+	return nil
+}
+
+func renewCertificate(o *openvpn.OpenVPN) error {
+	if err := o.RenewCertificate(); err != nil {
+		return fmt.Errorf("failed to renew certificate: %v", err)
+	}
+	return nil
+}
+
+func rotateCA(o *openvpn.OpenVPN) error {
+	if err := o.RotateCA(); err != nil {
+		return fmt.Errorf("failed to rotate certificate authority: %v",
+			err)
+	}
+	return nil
+}
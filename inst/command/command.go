@@ -14,6 +14,13 @@ import (
 
 // Execute executes a CLI command.
 func Execute(logger log.Logger, printVersion func(), args []string) {
+	progress, err := progressFlag()
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(2)
+	}
+	args = os.Args[1:]
+
 	if len(args) == 0 {
 		args = append(args, "help")
 	}
@@ -25,6 +32,10 @@ func Execute(logger log.Logger, printVersion func(), args []string) {
 		logger.Info("install process")
 		logger = logger.Add("action", "install")
 		flow = installFlow()
+	case "repair":
+		logger.Info("repair process")
+		logger = logger.Add("action", "repair")
+		flow = repairFlow(logger)
 	case "update":
 		logger.Info("update process")
 		logger = logger.Add("action", "update")
@@ -49,6 +60,28 @@ func Execute(logger log.Logger, printVersion func(), args []string) {
 		logger.Info("run adapter process")
 		logger = logger.Add("action", "run adapter")
 		flow = runAdapterFlow()
+	case "cert":
+		logger.Info("cert process")
+		logger = logger.Add("action", "cert")
+		if flow = certFlow(args[1:]); flow == nil {
+			fmt.Print(certHelp)
+			return
+		}
+	case "nat":
+		logger.Info("nat process")
+		logger = logger.Add("action", "nat")
+		if flow = natFlow(args[1:]); flow == nil {
+			fmt.Print(natHelp)
+			return
+		}
+	case "status":
+		logger.Info("status process")
+		logger = logger.Add("action", "status")
+		flow = statusFlow()
+	case "doctor":
+		logger.Info("doctor process")
+		logger = logger.Add("action", "doctor")
+		flow = doctorFlow()
 	case "help":
 		fmt.Println(rootHelp)
 		return
@@ -57,80 +90,143 @@ func Execute(logger log.Logger, printVersion func(), args []string) {
 		return
 	}
 
+	opts := []pipeline.Option{
+		pipeline.Before(stepHook(openvpn.HookBefore)),
+		pipeline.After(stepHook(openvpn.HookAfter)),
+	}
+	if progress == "json" {
+		opts = append(opts,
+			pipeline.WithSink(pipeline.JSONSink(os.Stdout)))
+	}
+
 	ovpn := openvpn.NewOpenVPN()
-	if err := flow.Run(ovpn, logger); err != nil {
+	if err := flow.Run(ovpn, logger, opts...); err != nil {
 		object, _ := json.Marshal(ovpn)
 		logger = logger.Add("object", string(object))
 		logger.Error(fmt.Sprintf("%v", err))
 		os.Exit(2)
 	}
 
+	if p := ovpn.Plan(); p != nil {
+		if err := printPlan(p); err != nil {
+			logger.Error(fmt.Sprintf("%v", err))
+			os.Exit(2)
+		}
+		logger.Info("dry run was successfully executed")
+		return
+	}
+
 	logger.Info("command was successfully executed")
 }
 
 func installFlow() pipeline.Flow {
 	return pipeline.Flow{
-		newOperator("processed flags", processedInstallFlags, nil),
-		newOperator("validate", validateToInstall, nil),
-		newOperator("install tap", installTap, removeTap),
-		newOperator("create config", createConfig, removeConfig),
-		newOperator("record ports.txt", recordPortsToOpen, removePortsFile),
-		newOperator("create service", createService, removeService),
-		newOperator("create env", createEnv, removeEnv),
-		newOperator("change owner", changeOwner, nil),
-		newOperator("start services", startServices, nil),
-		newOperator("finalize", finalize, nil),
+		newCheck("processed flags", processedInstallFlags),
+		newCheck("validate", validateToInstall),
+		newOperator("install tap", installTap, removeTap).
+			withPlan(planInstallTap),
+		newOperator("create config", createConfig, removeConfig).
+			withPlan(planCreateConfig),
+		newOperator("record ports.txt", recordPortsToOpen,
+			removePortsFile).withPlan(planPortsToOpen),
+		newOperator("create service", createService, removeService).
+			withPlan(planCreateService),
+		newOperator("create env", createEnv, removeEnv).
+			withPlan(planCreateEnv),
+		newOperator("change owner", changeOwner, nil).
+			withPlan(planChangeOwner),
+		newOperator("start services", startServices, nil).
+			withPlan(planStartServices),
+		newOperator("finalize", finalize, nil).withPlan(planFinalize),
+	}
+}
+
+// repairFlow rolls back the operations of the interrupted installation,
+// which are recorded in the journal as completed.
+func repairFlow(logger log.Logger) pipeline.Flow {
+	repair := func(o *openvpn.OpenVPN) error {
+		if err := resumeJournal(o, "install"); err != nil {
+			return err
+		}
+		// The journal belongs to the installation flow only.
+		defer o.SetJournal(nil)
+		return installFlow().Rollback(o, logger)
+	}
+
+	return pipeline.Flow{
+		newCheck("processed flags", processedCommonFlags),
+		newOperator("repair", repair, nil),
 	}
 }
 
 func removeFlow() pipeline.Flow {
 	return pipeline.Flow{
-		newOperator("processed flags", processedCommonFlags, nil),
-		newOperator("validate", checkInstallation, nil),
-		newOperator("stop service", stopService, nil),
-		newOperator("remove tap", removeTap, nil),
-		newOperator("remove service", removeService, nil),
-		newOperator("remove config", removeConfig, nil),
-		newOperator("remove env", removeEnv, nil),
+		newCheck("processed flags", processedCommonFlags),
+		newCheck("validate", checkInstallation),
+		newOperator("stop service", stopService, nil).
+			withPlan(planStopService),
+		newOperator("remove tap", removeTap, nil).
+			withPlan(planRemoveTap),
+		newOperator("remove service", removeService, nil).
+			withPlan(planRemoveService),
+		newOperator("remove config", removeConfig, nil).
+			withPlan(planRemoveConfig),
+		newOperator("remove env", removeEnv, nil).
+			withPlan(planRemoveEnv),
 	}
 }
 
 func updateFlow() pipeline.Flow {
 	return pipeline.Flow{
-		newOperator("processed flags", processedCommonFlags, nil),
-		newOperator("validate", checkInstallation, nil),
-		newOperator("update", update, nil),
+		newCheck("processed flags", processedCommonFlags),
+		newCheck("validate", checkInstallation),
+		newOperator("snapshot", snapshot, restoreSnapshot).
+			withPlan(planSnapshot),
+		newOperator("stop services", stopUpdated, nil).
+			withPlan(planStopUpdated),
+		newOperator("update", update, nil).withPlan(planUpdate),
+		newOperator("migrate config", migrateConfig, nil).
+			withPlan(planMigrateConfig),
+		newCheck("validate config", validateConfig),
+		newOperator("start services", startUpdated, stopUpdated).
+			withPlan(planStartUpdated),
+		newOperator("health check", healthCheck, nil).
+			withPlan(planHealthCheck),
 	}
 }
 
 func startFlow() pipeline.Flow {
 	return pipeline.Flow{
-		newOperator("processed flags", processedCommonFlags, nil),
-		newOperator("validate", checkInstallation, nil),
-		newOperator("start service", startService, nil),
+		newCheck("processed flags", processedCommonFlags),
+		newCheck("validate", checkInstallation),
+		newOperator("start service", startService, nil).
+			withPlan(planStartService),
+		newOperator("check update", checkUpdate, nil).
+			withPlan(planHealthCheck),
 	}
 }
 
 func stopFlow() pipeline.Flow {
 	return pipeline.Flow{
-		newOperator("processed flags", processedCommonFlags, nil),
-		newOperator("validate", checkInstallation, nil),
-		newOperator("stop service", stopService, nil),
+		newCheck("processed flags", processedCommonFlags),
+		newCheck("validate", checkInstallation),
+		newOperator("stop service", stopService, nil).
+			withPlan(planStopService),
 	}
 }
 
 func runFlow() pipeline.Flow {
 	return pipeline.Flow{
-		newOperator("processed flags", processedCommonFlags, nil),
-		newOperator("validate", checkInstallation, nil),
+		newCheck("processed flags", processedCommonFlags),
+		newCheck("validate", checkInstallation),
 		newOperator("run service", runService, nil),
 	}
 }
 
 func runAdapterFlow() pipeline.Flow {
 	return pipeline.Flow{
-		newOperator("processed flags", processedCommonFlags, nil),
-		newOperator("validate", checkInstallation, nil),
+		newCheck("processed flags", processedCommonFlags),
+		newCheck("validate", checkInstallation),
 		newOperator("run adapter", runAdapter, nil),
 	}
 }
@@ -5,12 +5,22 @@ Usage:
   installer [command] [flags]
 Available Commands:
   install     Install product package
+  repair      Roll back an interrupted installation
   remove      Remove product package
+  update      Update product package, restore it if the update fails.
+              On linux services are restarted with the container after
+              update and are checked by the next start
   run         Run service
   start	      Start service
   stop	      Stop service
+  status      Show services, ports, certificates, NAT rules and
+              adapter config state
+  doctor      Run diagnostics and suggest fixes
+  cert        Manage agent certificates
+  nat         Manage forwarding and NAT rules (linux)
 Flags:
   --help      Display help information
+  --progress  Print progress events of a command: json
   --version   Display the current version of this CLI
 Use "installer [command] --help" for more information about a command.
 `
@@ -20,7 +30,10 @@ Usage:
 	installer install [flags]
 Flags:
   --config  Configuration file
+  --dry-run Print changes without making them
+  --format  Dry run output format: text or json
   --help    Display help information
+  --resume  Continue an interrupted installation from the journal
   --role    Product role
   --workdir Product install directory
 `
@@ -29,8 +42,44 @@ const templateHelp = `
 Usage:
   installer %s [flags]
 Flags:
+  --dry-run Print changes without making them (install, remove, update)
+  --format  Output format of dry run, status and doctor: text or json
   --help    Display help information
   --workdir Product install directory
 `
 
-const envFile = "config/.env.config.json"
+const certHelp = `
+Usage:
+  installer cert [command] [flags]
+Available Commands:
+  status      Show subject, expiry and fingerprints of certificates
+  renew       Issue a new server certificate from the current CA
+              and restart services, connected clients reconnect
+  rotate-ca   Create a new CA, the CA file becomes a bundle of the new
+              and the current CA, and restart services. Run renew once
+              clients have received the bundle
+Flags:
+  --help      Display help information
+  --workdir   Product install directory
+`
+
+const natHelp = `
+Usage:
+  installer nat [command] [flags]
+Available Commands:
+  on          Enable forwarding and NAT for the tunnel subnet and apply
+              the egress firewall policy from config/firewall.config.json
+  reload      Apply a changed egress firewall policy
+  off         Remove NAT rules and restore the forwarding state
+  status      Show forwarding state, egress interface, firewall policy
+              and NAT rules
+Flags:
+  --help      Display help information
+  --workdir   Product install directory
+`
+
+const (
+	envFile     = "config/.env.config.json"
+	journalFile = "config/.install.journal.json"
+	portsFile   = "config/ports.txt"
+)
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"os/user"
@@ -16,6 +17,7 @@ import (
 
 	"github.com/privatix/dapp-openvpn/inst/env"
 	"github.com/privatix/dapp-openvpn/inst/openvpn"
+	"github.com/privatix/dapp-openvpn/inst/pipeline"
 )
 
 func processedRootFlags(printVersion func()) {
@@ -122,6 +124,9 @@ func processedInstallFlags(ovpn *openvpn.OpenVPN) error {
 	config := flag.String("config", "", "Configuration file")
 	role := flag.String("role", "", "Product role")
 	p := flag.String("workdir", "", "Product install directory")
+	resume := flag.Bool("resume", false,
+		"Continue an interrupted installation")
+	setPlan := planFlags()
 
 	flag.CommandLine.Parse(os.Args[2:])
 
@@ -130,6 +135,17 @@ func processedInstallFlags(ovpn *openvpn.OpenVPN) error {
 		os.Exit(0)
 	}
 
+	if err := setPlan(ovpn); err != nil {
+		return err
+	}
+
+	if *resume {
+		if len(*p) > 0 {
+			ovpn.Path = *p
+		}
+		return resumeJournal(ovpn, "install")
+	}
+
 	if len(*config) > 0 {
 		if err := util.ReadJSONFile(*config, &ovpn); err != nil {
 			return err
@@ -170,9 +186,38 @@ func validateToInstall(o *openvpn.OpenVPN) error {
 	o.Import = v.ProductImport
 
 	if v.ProductInstall || strings.EqualFold(o.Path, v.Workdir) {
-		err = errors.New("openvpn was installed at this workdir")
+		return errors.New("openvpn was installed at this workdir")
+	}
+
+	file := filepath.Join(o.Path, journalFile)
+	if _, err := os.Stat(file); err == nil {
+		return errors.New("interrupted installation was found," +
+			" run install with -resume flag or repair")
+	}
+	o.SetJournal(pipeline.NewJournal(file, "install"))
+	return nil
+}
+
+// resumeJournal restores the state of the interrupted flow from the journal.
+func resumeJournal(o *openvpn.OpenVPN, flow string) error {
+	if err := validatePath(o); err != nil {
+		return err
 	}
-	return err
+
+	j, err := pipeline.ReadJournal(filepath.Join(o.Path, journalFile))
+	if err != nil {
+		return fmt.Errorf("failed to read journal: %v", err)
+	}
+
+	if j.Flow != flow {
+		return fmt.Errorf("journal has a record of '%s' flow", j.Flow)
+	}
+
+	if err := j.Restore(o); err != nil {
+		return fmt.Errorf("failed to restore state: %v", err)
+	}
+	o.SetJournal(j)
+	return nil
 }
 
 func createConfig(o *openvpn.OpenVPN) error {
@@ -191,23 +236,22 @@ func removeConfig(o *openvpn.OpenVPN) error {
 }
 
 func recordPortsToOpen(o *openvpn.OpenVPN) error {
-	portsF, err := os.Create(filepath.Join(o.Path, "config/ports.txt"))
-	if err != nil {
-		return err
-	}
-	defer portsF.Close()
+	return ioutil.WriteFile(filepath.Join(o.Path, portsFile),
+		portsToOpen(o), 0644)
+}
 
-	_, err = fmt.Fprintf(portsF, "%d(%s)", o.Host.Port, o.Proto)
-	return err
+func portsToOpen(o *openvpn.OpenVPN) []byte {
+	return []byte(fmt.Sprintf("%d(%s)", o.Host.Port, o.Proto))
 }
 
 func removePortsFile(o *openvpn.OpenVPN) error {
-	return os.Remove(filepath.Join(o.Path, "config/ports.txt"))
+	return os.Remove(filepath.Join(o.Path, portsFile))
 }
 
 func processedCommonFlags(ovpn *openvpn.OpenVPN) error {
 	h := flag.Bool("help", false, "Display installer help")
 	p := flag.String("workdir", "..", "Product install directory")
+	setPlan := planFlags()
 
 	flag.CommandLine.Parse(os.Args[2:])
 
@@ -217,7 +261,7 @@ func processedCommonFlags(ovpn *openvpn.OpenVPN) error {
 	}
 
 	ovpn.Path = *p
-	return nil
+	return setPlan(ovpn)
 }
 
 func checkInstallation(o *openvpn.OpenVPN) error {
@@ -240,6 +284,7 @@ func checkInstallation(o *openvpn.OpenVPN) error {
 	o.Import = v.ProductImport
 	o.Install = v.ProductInstall
 	o.ForwardingState = v.ForwardingState
+	o.Subnet = v.Subnet
 
 	return nil
 }
@@ -254,6 +299,15 @@ func createEnv(o *openvpn.OpenVPN) error {
 		o.ForwardingState = strings.Replace(string(out), "\n", "", -1)
 	}
 
+	v := newEnv(o)
+	if err := v.Write(filepath.Join(o.Path, envFile)); err != nil {
+		return fmt.Errorf("failed to create env file: %v", err)
+	}
+
+	return nil
+}
+
+func newEnv(o *openvpn.OpenVPN) *env.Config {
 	v := env.NewConfig()
 
 	v.Workdir = o.Path
@@ -266,12 +320,8 @@ func createEnv(o *openvpn.OpenVPN) error {
 	v.ProductImport = o.Import
 	v.ProductInstall = o.Install
 	v.ForwardingState = o.ForwardingState
-
-	if err := v.Write(filepath.Join(o.Path, envFile)); err != nil {
-		return fmt.Errorf("failed to create env file: %v", err)
-	}
-
-	return nil
+	v.Subnet = o.Subnet
+	return v
 }
 
 func removeEnv(o *openvpn.OpenVPN) error {
@@ -350,28 +400,3 @@ func changeOwner(o *openvpn.OpenVPN) error {
 
 	return nil
 }
-
-func update(o *openvpn.OpenVPN) (err error) {
-	if runtime.GOOS == "linux" {
-		// doesn't need stop/start services,
-		// because container is used on linux
-		return o.Update()
-	}
-
-	err = stopService(o)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if err == nil {
-			err = startService(o)
-		}
-	}()
-
-	err = o.Update()
-	if err != nil {
-		return fmt.Errorf("failed to update product: %v", err)
-	}
-
-	return nil
-}
@@ -0,0 +1,95 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/privatix/dapp-openvpn/inst/openvpn"
+	"github.com/privatix/dapp-openvpn/inst/pipeline"
+)
+
+func natFlow(args []string) pipeline.Flow {
+	if len(args) == 0 {
+		return nil
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "on", "reload":
+		return pipeline.Flow{
+			newOperator("processed flags", processedNatFlags, nil),
+			newOperator("validate", checkInstallation, nil),
+			newOperator("nat on", natOn, nil),
+		}
+	case "off":
+		return pipeline.Flow{
+			newOperator("processed flags", processedNatFlags, nil),
+			newOperator("validate", checkInstallation, nil),
+			newOperator("nat off", natOff, nil),
+		}
+	case "status":
+		return pipeline.Flow{
+			newOperator("processed flags", processedNatFlags, nil),
+			newOperator("validate", checkInstallation, nil),
+			newOperator("print status", printNatStatus, nil),
+		}
+	}
+	return nil
+}
+
+func processedNatFlags(ovpn *openvpn.OpenVPN) error {
+	h := flag.Bool("help", false, "Display installer help")
+	p := flag.String("workdir", "..", "Product install directory")
+
+	if len(os.Args) > 3 {
+		flag.CommandLine.Parse(os.Args[3:])
+	}
+
+	if *h {
+		fmt.Print(natHelp)
+		os.Exit(0)
+	}
+
+	ovpn.Path = *p
+	return nil
+}
+
+func natOn(o *openvpn.OpenVPN) error {
+	if err := o.NATOn(); err != nil {
+		return fmt.Errorf("failed to enable nat: %v", err)
+	}
+	return nil
+}
+
+func natOff(o *openvpn.OpenVPN) error {
+	if err := o.NATOff(); err != nil {
+		return fmt.Errorf("failed to disable nat: %v", err)
+	}
+	return nil
+}
+
+func printNatStatus(o *openvpn.OpenVPN) error {
+	status, err := o.NATStatus()
+	if err != nil {
+		return fmt.Errorf("failed to read nat status: %v", err)
+	}
+
+	fmt.Printf("subnet:     %s\n", o.Subnet)
+	fmt.Printf("forwarding: %v\n", status.Forwarding)
+	fmt.Printf("egress:     %s\n", status.Egress)
+	fmt.Printf("backend:    %s\n", status.Backend)
+	fmt.Printf("policy:\n")
+	fmt.Printf("  client isolation: %v\n", o.Firewall.ClientIsolation)
+	fmt.Printf("  blocked networks: %s\n",
+		strings.Join(o.Firewall.BlockedNetworks, ", "))
+	fmt.Printf("  blocked ports:    %s\n",
+		strings.Join(o.Firewall.BlockedPorts, ", "))
+	fmt.Printf("  protocols:        %s\n",
+		strings.Join(o.Firewall.Protocols, ", "))
+	fmt.Printf("rules:\n")
+	for _, v := range status.Rules {
+		fmt.Printf("  %s\n", v)
+	}
+	return nil
+}
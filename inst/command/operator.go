@@ -1,12 +1,21 @@
 package command
 
-import "github.com/privatix/dapp-openvpn/inst/openvpn"
+import (
+	"errors"
 
-// operator implement the Runner interface in pipeline package.
+	"github.com/privatix/dapp-openvpn/inst/openvpn"
+	"github.com/privatix/dapp-openvpn/inst/pipeline"
+)
+
+// errDryRun is returned by operators, which can not be planned.
+var errDryRun = errors.New("dry run is not supported")
+
+// operator implement the Runner and Planner interfaces in pipeline package.
 type operator struct {
 	name   string
 	run    func(*openvpn.OpenVPN) error
 	cancel func(*openvpn.OpenVPN) error
+	plan   func(*openvpn.OpenVPN) ([]pipeline.Change, error)
 }
 
 // Name returns the operators name.
@@ -24,6 +33,22 @@ func (o operator) Cancel(in interface{}) error {
 	return o.cancel(in.(*openvpn.OpenVPN))
 }
 
+// Plan executes the operators plan function.
+func (o operator) Plan(in interface{}) ([]pipeline.Change, error) {
+	if o.plan == nil {
+		return nil, errDryRun
+	}
+	return o.plan(in.(*openvpn.OpenVPN))
+}
+
+// withPlan returns the operator with the plan function, which describes
+// the changes of the run function.
+func (o operator) withPlan(
+	plan func(*openvpn.OpenVPN) ([]pipeline.Change, error)) operator {
+	o.plan = plan
+	return o
+}
+
 func newOperator(name string, run func(*openvpn.OpenVPN) error,
 	cancel func(*openvpn.OpenVPN) error) operator {
 	if cancel == nil {
@@ -31,3 +56,12 @@ func newOperator(name string, run func(*openvpn.OpenVPN) error,
 	}
 	return operator{name: name, run: run, cancel: cancel}
 }
+
+// newCheck creates an operator, which makes no changes. It is executed
+// on dry run as well.
+func newCheck(name string, run func(*openvpn.OpenVPN) error) operator {
+	return newOperator(name, run, nil).withPlan(
+		func(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+			return nil, run(o)
+		})
+}
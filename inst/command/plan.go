@@ -0,0 +1,183 @@
+package command
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/privatix/dapp-openvpn/inst/env"
+	"github.com/privatix/dapp-openvpn/inst/openvpn"
+	"github.com/privatix/dapp-openvpn/inst/pipeline"
+)
+
+// outputFormat is a format of the printed plan, status and diagnostics.
+var outputFormat = "text"
+
+// planFlags defines the dry run and the output format flags. The returned
+// function makes the flow to be planned, if the dry run is requested.
+func planFlags() func(*openvpn.OpenVPN) error {
+	dryRun := flag.Bool("dry-run", false,
+		"Print changes without making them")
+	format := flag.String("format", outputFormat,
+		"Output format: text or json")
+
+	return func(o *openvpn.OpenVPN) error {
+		if *format != "text" && *format != "json" {
+			return fmt.Errorf("unknown output format: %s", *format)
+		}
+		outputFormat = *format
+
+		if *dryRun {
+			o.SetPlan(&pipeline.Plan{})
+		}
+		return nil
+	}
+}
+
+// printJSON prints the value as json, if it is the output format.
+func printJSON(v interface{}) (bool, error) {
+	if outputFormat != "json" {
+		return false, nil
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return true, err
+	}
+	fmt.Println(string(data))
+	return true, nil
+}
+
+func printPlan(p *pipeline.Plan) error {
+	if ok, err := printJSON(p); ok {
+		return err
+	}
+
+	fmt.Print(p)
+	return nil
+}
+
+func planInstallTap(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+	return o.PlanInstallTap(), nil
+}
+
+func planRemoveTap(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+	return o.PlanRemoveTap(), nil
+}
+
+func planCreateConfig(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+	changes, err := o.PlanConfigurate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure openvpn: %v", err)
+	}
+
+	adapter, err := o.Adapter.PlanConfigurate(o)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure adapter: %v", err)
+	}
+	return append(changes, adapter...), nil
+}
+
+func planRemoveConfig(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+	return o.PlanRemoveConfig(), nil
+}
+
+func planPortsToOpen(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+	return []pipeline.Change{pipeline.FileChange(
+		filepath.Join(o.Path, portsFile), portsToOpen(o))}, nil
+}
+
+func planCreateService(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+	changes := append(o.PlanInstallService(),
+		o.Adapter.PlanInstallService(o.Path)...)
+	if !o.IsWindows {
+		return changes, nil
+	}
+
+	name := strings.Replace(o.Adapter.Service, " ", "_", -1)
+	return append(changes, pipeline.CommandChange("sc", "failure", name,
+		"reset=", "0", "actions=",
+		"restart/1000/restart/2000/restart/5000")), nil
+}
+
+func planStartService(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+	return append(o.PlanServiceAction("start"),
+		o.Adapter.PlanServiceAction("start")...), nil
+}
+
+func planStopService(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+	return append(o.Adapter.PlanServiceAction("stop"),
+		o.PlanServiceAction("stop")...), nil
+}
+
+func planRemoveService(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+	return append(o.Adapter.PlanServiceAction("remove"),
+		o.PlanRemoveService()...), nil
+}
+
+func planCreateEnv(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+	return planWriteEnv(o, newEnv(o))
+}
+
+func planRemoveEnv(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+	if !o.Import {
+		return []pipeline.Change{{
+			Kind:   pipeline.KindFile,
+			Target: filepath.Join(o.Path, envFile),
+			Action: "remove",
+		}}, nil
+	}
+
+	v := env.NewConfig()
+	v.ProductImport = o.Import
+	return planWriteEnv(o, v)
+}
+
+func planWriteEnv(o *openvpn.OpenVPN,
+	v *env.Config) ([]pipeline.Change, error) {
+	data, err := v.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return []pipeline.Change{
+		pipeline.FileChange(filepath.Join(o.Path, envFile), data)}, nil
+}
+
+func planChangeOwner(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+	if runtime.GOOS != "darwin" {
+		return nil, nil
+	}
+	return []pipeline.Change{pipeline.CommandChange("chown", "<logname>",
+		filepath.Join(o.Path, envFile))}, nil
+}
+
+func planStartServices(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+	return []pipeline.Change{
+		pipeline.CommandChange(os.Args[0], "start")}, nil
+}
+
+func planFinalize(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+	if !strings.EqualFold(o.Role, "server") {
+		return nil, nil
+	}
+
+	if !o.IsWindows {
+		return o.PlanForwardingDaemon(), nil
+	}
+
+	changes, _ := planStopService(o)
+	return append(changes,
+		pipeline.CommandChange(os.Args[0], "start")), nil
+}
+
+func planUpdate(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+	changes, err := o.PlanUpdate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to update product: %v", err)
+	}
+	return changes, nil
+}
@@ -0,0 +1,46 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/privatix/dapp-openvpn/inst/openvpn"
+	"github.com/privatix/dapp-openvpn/inst/pipeline"
+)
+
+// progressFlag removes the progress flag from the command line, so that
+// it is accepted by every command, and returns the flag value.
+func progressFlag() (string, error) {
+	var progress string
+	args := []string{os.Args[0]}
+	for i := 1; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		name := strings.TrimLeft(arg, "-")
+		switch {
+		case arg == name:
+			args = append(args, arg)
+		case name == "progress" && i+1 < len(os.Args):
+			progress = os.Args[i+1]
+			i++
+		case strings.HasPrefix(name, "progress="):
+			progress = strings.TrimPrefix(name, "progress=")
+		default:
+			args = append(args, arg)
+		}
+	}
+	os.Args = args
+
+	if progress != "" && progress != "json" {
+		return "", fmt.Errorf("unknown progress format: %s", progress)
+	}
+	return progress, nil
+}
+
+// stepHook returns a pipeline hook, which executes the command configured
+// for the step in the installer configuration.
+func stepHook(stage string) pipeline.Hook {
+	return func(step string, in interface{}) error {
+		return in.(*openvpn.OpenVPN).RunHook(stage, step)
+	}
+}
@@ -0,0 +1,109 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/privatix/dapp-openvpn/inst/openvpn"
+	"github.com/privatix/dapp-openvpn/inst/pipeline"
+)
+
+func statusFlow() pipeline.Flow {
+	return pipeline.Flow{
+		newCheck("processed flags", processedCommonFlags),
+		newCheck("validate", checkInstallation),
+		newOperator("print status", printStatus, nil),
+	}
+}
+
+func doctorFlow() pipeline.Flow {
+	return pipeline.Flow{
+		newCheck("processed flags", processedCommonFlags),
+		newCheck("validate", checkInstallation),
+		newOperator("run diagnostics", runDiagnostics, nil),
+	}
+}
+
+func printStatus(o *openvpn.OpenVPN) error {
+	s := o.Status()
+	if ok, err := printJSON(s); ok {
+		return err
+	}
+
+	fmt.Printf("workdir: %s\n", o.Path)
+	fmt.Printf("role:    %s\n", o.Role)
+	fmt.Printf("services:\n")
+	for _, v := range s.Services {
+		fmt.Printf("  %s: %s\n", v.Name, v.Status)
+	}
+
+	if len(s.Ports) != 0 {
+		fmt.Printf("ports:\n")
+	}
+	for _, v := range s.Ports {
+		state := "not listening"
+		if v.Listening {
+			state = "listening"
+		}
+		fmt.Printf("  %s: %s %s %s\n", v.Name, v.Proto, v.Addr, state)
+	}
+
+	if len(s.Certificates) != 0 || len(s.CertificatesError) != 0 {
+		fmt.Printf("certificates:\n")
+	}
+	if len(s.CertificatesError) != 0 {
+		fmt.Printf("  error: %s\n", s.CertificatesError)
+	}
+	now := time.Now()
+	for _, c := range s.Certificates {
+		days := int(c.NotAfter.Sub(now).Hours() / 24)
+		fmt.Printf("  %s: expires %s (%d days left)\n", c.File,
+			c.NotAfter.Format(time.RFC3339), days)
+	}
+
+	if s.NAT != nil {
+		fmt.Printf("nat:\n")
+		fmt.Printf("  forwarding: %v\n", s.NAT.Forwarding)
+		fmt.Printf("  rules:      %d\n", len(s.NAT.Rules))
+	} else if len(s.NATError) != 0 {
+		fmt.Printf("nat:\n")
+		fmt.Printf("  error: %s\n", s.NATError)
+	}
+
+	adapter := "valid"
+	if len(s.AdapterConfigError) != 0 {
+		adapter = s.AdapterConfigError
+	}
+	fmt.Printf("adapter config: %s\n", adapter)
+	return nil
+}
+
+func runDiagnostics(o *openvpn.OpenVPN) error {
+	result := o.Doctor()
+
+	var failed []string
+	for _, d := range result {
+		if d.Result == openvpn.DiagnosisFailed {
+			failed = append(failed, d.Check)
+		}
+	}
+
+	if ok, err := printJSON(result); !ok {
+		for _, d := range result {
+			fmt.Printf("[%s] %s: %s\n", d.Result, d.Check, d.Detail)
+			if len(d.Fix) != 0 {
+				fmt.Printf("  fix: %s\n", d.Fix)
+			}
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if len(failed) != 0 {
+		return errors.New("failed diagnostics: " +
+			strings.Join(failed, ", "))
+	}
+	return nil
+}
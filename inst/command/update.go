@@ -0,0 +1,187 @@
+package command
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/privatix/dapp-openvpn/inst/env"
+	"github.com/privatix/dapp-openvpn/inst/openvpn"
+	"github.com/privatix/dapp-openvpn/inst/openvpn/path"
+	"github.com/privatix/dapp-openvpn/inst/pipeline"
+)
+
+// healthTimeout is a time to wait for the updated services to run.
+const healthTimeout = 30 * time.Second
+
+// managedServices tells whether the installer stops and starts services
+// on update. On linux the services run in a container, which is restarted
+// after the installer exits, so the update is checked by the next start.
+func managedServices() bool {
+	return runtime.GOOS != "linux"
+}
+
+func snapshot(o *openvpn.OpenVPN) error {
+	if err := o.Snapshot(); err != nil {
+		return fmt.Errorf("failed to make snapshot: %v", err)
+	}
+	return nil
+}
+
+// restoreSnapshot returns the product to the state before update and
+// starts it again.
+func restoreSnapshot(o *openvpn.OpenVPN) error {
+	if err := o.RestoreSnapshot(); err != nil {
+		return fmt.Errorf("failed to restore snapshot: %v", err)
+	}
+	return startUpdated(o)
+}
+
+func planSnapshot(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+	return []pipeline.Change{{
+		Kind:   pipeline.KindFile,
+		Target: filepath.Join(o.Path, path.Config.BackupDir),
+		Action: "create",
+	}}, nil
+}
+
+func stopUpdated(o *openvpn.OpenVPN) error {
+	if !managedServices() {
+		return nil
+	}
+	return stopService(o)
+}
+
+func planStopUpdated(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+	if !managedServices() {
+		return nil, nil
+	}
+	return planStopService(o)
+}
+
+func update(o *openvpn.OpenVPN) error {
+	if err := o.Update(); err != nil {
+		return fmt.Errorf("failed to update product: %v", err)
+	}
+	return nil
+}
+
+// envSchema returns the schema version of the stored environment configs.
+func envSchema(o *openvpn.OpenVPN) (string, error) {
+	v := &env.Config{}
+	if err := v.Read(filepath.Join(o.Path, envFile)); err != nil {
+		return "", err
+	}
+	return v.Schema, nil
+}
+
+func migrateConfig(o *openvpn.OpenVPN) error {
+	schema, err := envSchema(o)
+	if err != nil {
+		return err
+	}
+
+	if _, err := o.Migrate(schema); err != nil {
+		return err
+	}
+	return newEnv(o).Write(filepath.Join(o.Path, envFile))
+}
+
+func planMigrateConfig(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+	schema, err := envSchema(o)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := o.PlanMigrate(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	write, err := planWriteEnv(o, newEnv(o))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range write {
+		if c.Action != "keep" {
+			changes = append(changes, c)
+		}
+	}
+	return changes, nil
+}
+
+func validateConfig(o *openvpn.OpenVPN) error {
+	if err := o.ValidateConfig(); err != nil {
+		return fmt.Errorf("updated config is invalid: %v", err)
+	}
+	return nil
+}
+
+func startUpdated(o *openvpn.OpenVPN) error {
+	if !managedServices() {
+		return nil
+	}
+	return startService(o)
+}
+
+func planStartUpdated(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+	if !managedServices() {
+		return nil, nil
+	}
+	return planStartService(o)
+}
+
+// healthCheck waits for the updated services to run. On linux the update
+// is recorded to be checked once the container is restarted.
+func healthCheck(o *openvpn.OpenVPN) error {
+	if !managedServices() {
+		if err := o.MarkPending(); err != nil {
+			return fmt.Errorf("failed to record update: %v", err)
+		}
+		return nil
+	}
+
+	if err := o.HealthCheck(healthTimeout); err != nil {
+		return fmt.Errorf("updated product is not healthy: %v", err)
+	}
+	return nil
+}
+
+func planHealthCheck(o *openvpn.OpenVPN) ([]pipeline.Change, error) {
+	return nil, nil
+}
+
+// checkUpdate checks an update, which services were started after
+// the installer exited. If the product is not healthy, the snapshot is
+// restored and the services are restarted.
+func checkUpdate(o *openvpn.OpenVPN) error {
+	pending, err := o.PendingUpdate()
+	if err != nil || !pending {
+		return err
+	}
+
+	if err := o.ClearPending(); err != nil {
+		return err
+	}
+
+	health := o.HealthCheck(healthTimeout)
+	if health == nil {
+		return nil
+	}
+
+	if err := stopService(o); err != nil {
+		return err
+	}
+
+	if err := o.RestoreSnapshot(); err != nil {
+		return fmt.Errorf("failed to restore snapshot: %v", err)
+	}
+
+	if err := startService(o); err != nil {
+		return err
+	}
+	return fmt.Errorf("updated product is not healthy, snapshot is"+
+		" restored: %v", health)
+}
@@ -1,12 +1,16 @@
 package env
 
 import (
+	"bytes"
 	"encoding/json"
 	"os"
 
 	"github.com/privatix/dappctrl/util"
 )
 
+// Schema is the current version of the configs.
+const Schema = "1.1"
+
 // Config has a store environment variables.
 type Config struct {
 	Schema          string
@@ -18,13 +22,14 @@ type Config struct {
 	Role            string
 	Adapter         string
 	ForwardingState string
+	Subnet          string
 	ProductImport   bool
 	ProductInstall  bool
 }
 
 // NewConfig creates a default Configs configuration.
 func NewConfig() *Config {
-	return &Config{Schema: "1.0"}
+	return &Config{Schema: Schema}
 }
 
 // Write saves the configs to json file.
@@ -37,6 +42,15 @@ func (c *Config) Write(path string) error {
 	return json.NewEncoder(write).Encode(c)
 }
 
+// Bytes returns the configs as they are saved to json file.
+func (c *Config) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(c); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // Read reads the configs from json file.
 func (c *Config) Read(path string) error {
 	return util.ReadJSONFile(path, &c)
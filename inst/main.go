@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -31,9 +32,13 @@ func createLogger() (log.Logger, io.Closer, error) {
 	}
 
 	f := flag.NewFlagSet("", flag.ContinueOnError)
+	f.SetOutput(ioutil.Discard)
 	p := f.String("workdir", "..", "Product install directory")
 
-	if len(os.Args) > 2 && !strings.EqualFold(os.Args[1], "install") {
+	if len(os.Args) > 3 && (strings.EqualFold(os.Args[1], "cert") ||
+		strings.EqualFold(os.Args[1], "nat")) {
+		f.Parse(os.Args[3:])
+	} else if len(os.Args) > 2 && !strings.EqualFold(os.Args[1], "install") {
 		f.Parse(os.Args[2:])
 	}
 
@@ -0,0 +1,148 @@
+package nat
+
+import (
+	"strconv"
+	"strings"
+)
+
+// iptables applies rules marked with an owner comment.
+type iptables struct {
+	path string
+}
+
+type iptablesRule struct {
+	table string
+	chain string
+	spec  []string
+}
+
+func (t *iptables) name() string {
+	return "iptables"
+}
+
+func (t *iptables) rules(r *rules) []iptablesRule {
+	list := []iptablesRule{{"nat", "POSTROUTING",
+		[]string{"-s", r.subnet, "-o", r.egress, "-j", "MASQUERADE"}}}
+
+	// Rules are inserted to the top of FORWARD in the order of
+	// evaluation. Only replies to the tunnel subnet are accepted, other
+	// forwarded traffic is left to the rest of the chain.
+	list = append(list, iptablesRule{"filter", "FORWARD",
+		[]string{"-i", r.egress, "-d", r.subnet, "-m", "conntrack",
+			"--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"}})
+	if r.isolation {
+		list = append(list, iptablesRule{"filter", "FORWARD",
+			[]string{"-s", r.subnet, "-d", r.subnet, "-j", "DROP"}})
+	}
+	for _, v := range r.blocked {
+		list = append(list, iptablesRule{"filter", "FORWARD",
+			[]string{"-s", r.subnet, "-d", v, "-j", "DROP"}})
+	}
+	for _, p := range r.ports {
+		for _, proto := range p.protos() {
+			list = append(list, iptablesRule{"filter", "FORWARD",
+				[]string{"-s", r.subnet, "-p", proto,
+					"--dport", p.span(":"), "-j", "DROP"}})
+		}
+	}
+	if len(r.protocols) == 0 {
+		return append(list, iptablesRule{"filter", "FORWARD",
+			[]string{"-s", r.subnet, "-o", r.egress, "-j", "ACCEPT"}})
+	}
+	for _, proto := range r.protocols {
+		list = append(list, iptablesRule{"filter", "FORWARD",
+			[]string{"-s", r.subnet, "-o", r.egress, "-p", proto,
+				"-j", "ACCEPT"}})
+	}
+	list = append(list, iptablesRule{"filter", "FORWARD",
+		[]string{"-s", r.subnet, "-j", "DROP"}})
+	return list
+}
+
+// apply removes owned rules and adds them again.
+func (t *iptables) apply(r *rules) error {
+	if err := t.remove(r.tag); err != nil {
+		return err
+	}
+
+	comment := []string{"-m", "comment", "--comment", ownerComment(r.tag)}
+	pos := 1
+	for _, v := range t.rules(r) {
+		args := []string{"-t", v.table}
+		if v.chain == "FORWARD" {
+			args = append(args, "-I", v.chain, strconv.Itoa(pos))
+			pos++
+		} else {
+			args = append(args, "-A", v.chain)
+		}
+		args = append(append(args, v.spec...), comment...)
+
+		if _, err := run(t.path, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// owned returns owned rules of a chain as printed by "iptables -S".
+func (t *iptables) owned(table, chain, tag string) ([]string, error) {
+	out, err := run(t.path, "-t", table, "-S", chain)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []string
+	for _, line := range strings.Split(out, "\n") {
+		if strings.Contains(line, ownerComment(tag)) {
+			list = append(list, strings.TrimSpace(line))
+		}
+	}
+	return list, nil
+}
+
+func (t *iptables) remove(tag string) error {
+	for _, v := range []iptablesRule{{"nat", "POSTROUTING", nil},
+		{"filter", "FORWARD", nil}} {
+		list, err := t.owned(v.table, v.chain, tag)
+		if err != nil {
+			return err
+		}
+
+		for _, rule := range list {
+			args := deleteArgs(rule)
+			_, err := run(t.path, append([]string{"-t", v.table},
+				args...)...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deleteArgs turns a rule printed by "iptables -S" into arguments to delete
+// it. Owned rules have no spaces in arguments, but iptables quotes comments.
+func deleteArgs(rule string) []string {
+	args := strings.Fields(rule)
+	for i, v := range args {
+		args[i] = strings.Trim(v, `"`)
+	}
+	args[0] = "-D"
+	return args
+}
+
+func (t *iptables) list(tag string) ([]string, error) {
+	var list []string
+	for _, v := range []iptablesRule{{"nat", "POSTROUTING", nil},
+		{"filter", "FORWARD", nil}} {
+		owned, err := t.owned(v.table, v.chain, tag)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rule := range owned {
+			list = append(list, "-t "+v.table+" "+rule)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,129 @@
+// Package nat manages IP forwarding, masquerading and forwarding rules for
+// VPN clients.
+package nat
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Config is a NAT configuration.
+type Config struct {
+	Tag       string // Owner tag of created rules.
+	Subnet    string // Tunnel subnet in CIDR notation.
+	Egress    string // Egress interface, detected when empty.
+	StateFile string // Keeps forwarding state to restore.
+	Policy    *Policy
+}
+
+// Status is a NAT status.
+type Status struct {
+	Forwarding bool
+	Egress     string
+	Backend    string
+	Rules      []string
+}
+
+// rules are rules to apply for a configuration.
+type rules struct {
+	tag       string
+	subnet    string
+	egress    string
+	isolation bool
+	blocked   []string
+	ports     []port
+	protocols []string
+}
+
+// backend is a firewall to apply rules with.
+type backend interface {
+	name() string
+	apply(r *rules) error
+	remove(tag string) error
+	list(tag string) ([]string, error)
+}
+
+func (c *Config) validate() error {
+	if len(c.Tag) == 0 {
+		return fmt.Errorf("no rule owner tag")
+	}
+	if len(c.Subnet) == 0 {
+		return fmt.Errorf("no tunnel subnet")
+	}
+	if c.Policy == nil {
+		c.Policy = DefaultPolicy()
+	}
+	return c.Policy.Validate()
+}
+
+// rules returns rules of the configuration for a given egress interface.
+func (c *Config) rules(egress string) (*rules, error) {
+	blocked, err := c.Policy.networks()
+	if err != nil {
+		return nil, err
+	}
+
+	ports, err := c.Policy.ports()
+	if err != nil {
+		return nil, err
+	}
+
+	protocols, err := c.Policy.protocols()
+	if err != nil {
+		return nil, err
+	}
+
+	return &rules{
+		tag:       c.Tag,
+		subnet:    c.Subnet,
+		egress:    egress,
+		isolation: c.Policy.ClientIsolation,
+		blocked:   blocked,
+		ports:     ports,
+		protocols: protocols,
+	}, nil
+}
+
+// ownerComment is a comment which marks rules of a given owner.
+func ownerComment(tag string) string {
+	return "privatix:" + tag
+}
+
+// saveForwarding remembers forwarding state, unless it's already saved.
+func saveForwarding(file string, enabled bool) error {
+	if len(file) == 0 {
+		return nil
+	}
+
+	if _, err := os.Stat(file); err == nil {
+		return nil
+	}
+
+	state := "0"
+	if enabled {
+		state = "1"
+	}
+	return ioutil.WriteFile(file, []byte(state), 0644)
+}
+
+// savedForwarding returns a saved forwarding state and removes it.
+// Forwarding is assumed to be enabled when the state is unknown.
+func savedForwarding(file string) (bool, error) {
+	if len(file) == 0 {
+		return true, nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if err := os.Remove(file); err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(data)) != "0", nil
+}
@@ -0,0 +1,250 @@
+package nat
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	forwardingFile = "/proc/sys/net/ipv4/ip_forward"
+	routeFile      = "/proc/net/route"
+)
+
+// On enables forwarding and applies NAT rules and the egress policy. Rules of
+// the same owner are replaced, so it's safe to call it again to apply
+// a changed policy.
+func On(conf *Config) error {
+	if err := conf.validate(); err != nil {
+		return err
+	}
+
+	egress, err := egressInterface(conf)
+	if err != nil {
+		return err
+	}
+
+	r, err := conf.rules(egress)
+	if err != nil {
+		return err
+	}
+
+	b, err := newBackend()
+	if err != nil {
+		return err
+	}
+
+	enabled, err := forwarding()
+	if err != nil {
+		return err
+	}
+
+	if err := saveForwarding(conf.StateFile, enabled); err != nil {
+		return err
+	}
+
+	if !enabled {
+		if err := setForwarding(true); err != nil {
+			return err
+		}
+	}
+
+	removeStale(b, conf.Tag)
+
+	return b.apply(r)
+}
+
+// Off removes NAT rules and restores forwarding state.
+func Off(conf *Config) error {
+	if err := conf.validate(); err != nil {
+		return err
+	}
+
+	b, err := newBackend()
+	if err != nil {
+		return err
+	}
+
+	if err := b.remove(conf.Tag); err != nil {
+		return err
+	}
+
+	removeStale(b, conf.Tag)
+
+	enabled, err := savedForwarding(conf.StateFile)
+	if err != nil || enabled {
+		return err
+	}
+	return setForwarding(false)
+}
+
+// GetStatus returns forwarding state and applied NAT rules.
+func GetStatus(conf *Config) (*Status, error) {
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
+
+	b, err := newBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	enabled, err := forwarding()
+	if err != nil {
+		return nil, err
+	}
+
+	egress, _ := egressInterface(conf)
+
+	list, err := b.list(conf.Tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Status{
+		Forwarding: enabled,
+		Egress:     egress,
+		Backend:    b.name(),
+		Rules:      list,
+	}, nil
+}
+
+// newBackend prefers nftables and falls back to iptables. An accept in an
+// own nftables table does not override a drop in the iptables FORWARD
+// chain, e.g. of docker or ufw over iptables-nft, so iptables is used when
+// the chain filters forwarded traffic.
+func newBackend() (backend, error) {
+	ipt, iptErr := exec.LookPath("iptables")
+	if iptErr == nil {
+		out, err := run(ipt, "-S", "FORWARD")
+		if err == nil && filtersForward(out) {
+			return &iptables{path: ipt}, nil
+		}
+	}
+
+	if path, err := exec.LookPath("nft"); err == nil {
+		return &nftables{path: path}, nil
+	}
+
+	if iptErr == nil {
+		return &iptables{path: ipt}, nil
+	}
+
+	return nil, fmt.Errorf("neither nft nor iptables is found")
+}
+
+// removeStale removes rules applied by a backend other than a given one.
+// The backend changes, when the iptables FORWARD chain starts or stops
+// filtering forwarded traffic. Errors are ignored, since the other backend
+// may be unusable on the host.
+func removeStale(b backend, tag string) {
+	var other backend
+	if _, ok := b.(*iptables); ok {
+		if path, err := exec.LookPath("nft"); err == nil {
+			other = &nftables{path: path}
+		}
+	} else if path, err := exec.LookPath("iptables"); err == nil {
+		other = &iptables{path: path}
+	}
+
+	if other != nil {
+		other.remove(tag)
+	}
+}
+
+// filtersForward returns true if the FORWARD chain printed by
+// "iptables -S FORWARD" has rules or a policy other than ACCEPT.
+func filtersForward(chain string) bool {
+	for _, line := range strings.Split(chain, "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case fields[0] == "-P":
+			if fields[len(fields)-1] != "ACCEPT" {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// Forwarding returns true if IPv4 forwarding is enabled.
+func Forwarding() (bool, error) {
+	return forwarding()
+}
+
+func forwarding() (bool, error) {
+	data, err := ioutil.ReadFile(forwardingFile)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(data)) == "1", nil
+}
+
+func setForwarding(enabled bool) error {
+	value := "0"
+	if enabled {
+		value = "1"
+	}
+	return ioutil.WriteFile(forwardingFile, []byte(value), 0644)
+}
+
+// egressInterface returns a configured egress interface or an interface of
+// the default route with the lowest metric.
+func egressInterface(conf *Config) (string, error) {
+	if len(conf.Egress) != 0 {
+		return conf.Egress, nil
+	}
+
+	file, err := os.Open(routeFile)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var iface string
+	var metric uint64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[1] != "00000000" ||
+			fields[7] != "00000000" {
+			continue
+		}
+
+		m, err := strconv.ParseUint(fields[6], 10, 32)
+		if err != nil {
+			continue
+		}
+
+		if len(iface) == 0 || m < metric {
+			iface, metric = fields[0], m
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	if len(iface) == 0 {
+		return "", fmt.Errorf("no default route found")
+	}
+	return iface, nil
+}
+
+func run(name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %v: %s", name,
+			strings.Join(args, " "), err,
+			strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
@@ -0,0 +1,151 @@
+// +build !nonattest
+
+package nat
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	established = "FORWARD -i eth0 -d 10.217.3.0/24 -m conntrack " +
+		"--ctstate RELATED,ESTABLISHED -j ACCEPT"
+	nftEstablished = `iifname "eth0" ip daddr 10.217.3.0/24 ` +
+		"ct state established,related accept"
+)
+
+func plainRules() *rules {
+	return &rules{tag: "server", subnet: "10.217.3.0/24", egress: "eth0"}
+}
+
+func testRules() *rules {
+	return &rules{
+		tag:       "server",
+		subnet:    "10.217.3.0/24",
+		egress:    "eth0",
+		isolation: true,
+		blocked:   []string{"10.0.0.0/8", "192.168.0.0/16"},
+		ports:     []port{{proto: ProtoTCP, from: 25, to: 25}},
+	}
+}
+
+func TestIptablesRules(t *testing.T) {
+	allowed := testRules()
+	allowed.protocols = []string{ProtoTCP, ProtoICMP}
+
+	tests := []struct {
+		r        *rules
+		expected []string
+	}{
+		{plainRules(), []string{
+			"POSTROUTING -s 10.217.3.0/24 -o eth0 -j MASQUERADE",
+			established,
+			"FORWARD -s 10.217.3.0/24 -o eth0 -j ACCEPT",
+		}},
+		{testRules(), []string{
+			"POSTROUTING -s 10.217.3.0/24 -o eth0 -j MASQUERADE",
+			established,
+			"FORWARD -s 10.217.3.0/24 -d 10.217.3.0/24 -j DROP",
+			"FORWARD -s 10.217.3.0/24 -d 10.0.0.0/8 -j DROP",
+			"FORWARD -s 10.217.3.0/24 -d 192.168.0.0/16 -j DROP",
+			"FORWARD -s 10.217.3.0/24 -p tcp --dport 25 -j DROP",
+			"FORWARD -s 10.217.3.0/24 -o eth0 -j ACCEPT",
+		}},
+		{allowed, []string{
+			"POSTROUTING -s 10.217.3.0/24 -o eth0 -j MASQUERADE",
+			established,
+			"FORWARD -s 10.217.3.0/24 -d 10.217.3.0/24 -j DROP",
+			"FORWARD -s 10.217.3.0/24 -d 10.0.0.0/8 -j DROP",
+			"FORWARD -s 10.217.3.0/24 -d 192.168.0.0/16 -j DROP",
+			"FORWARD -s 10.217.3.0/24 -p tcp --dport 25 -j DROP",
+			"FORWARD -s 10.217.3.0/24 -o eth0 -p tcp -j ACCEPT",
+			"FORWARD -s 10.217.3.0/24 -o eth0 -p icmp -j ACCEPT",
+			"FORWARD -s 10.217.3.0/24 -j DROP",
+		}},
+	}
+
+	for _, v := range tests {
+		var list []string
+		for _, rule := range (&iptables{}).rules(v.r) {
+			list = append(list,
+				rule.chain+" "+strings.Join(rule.spec, " "))
+		}
+		if !reflect.DeepEqual(list, v.expected) {
+			t.Errorf("wrong iptables rules:\n%s",
+				strings.Join(list, "\n"))
+		}
+	}
+}
+
+func TestDeleteArgs(t *testing.T) {
+	rule := `-A FORWARD -s 10.217.3.0/24 -j DROP ` +
+		`-m comment --comment "privatix:server"`
+	expected := []string{"-D", "FORWARD", "-s", "10.217.3.0/24",
+		"-j", "DROP", "-m", "comment", "--comment", "privatix:server"}
+
+	if args := deleteArgs(rule); !reflect.DeepEqual(args, expected) {
+		t.Errorf("wrong delete arguments: %v", args)
+	}
+}
+
+func TestNftablesForward(t *testing.T) {
+	allowed := testRules()
+	allowed.ports = []port{{from: 6881, to: 6889}}
+	allowed.protocols = []string{ProtoTCP, ProtoUDP}
+
+	tests := []struct {
+		r        *rules
+		expected []string
+	}{
+		{plainRules(), []string{
+			nftEstablished,
+			`ip saddr 10.217.3.0/24 oifname "eth0" accept`,
+		}},
+		{testRules(), []string{
+			nftEstablished,
+			"ip saddr 10.217.3.0/24 ip daddr 10.217.3.0/24 drop",
+			"ip saddr 10.217.3.0/24 ip daddr " +
+				"{ 10.0.0.0/8, 192.168.0.0/16 } drop",
+			"ip saddr 10.217.3.0/24 tcp dport 25 drop",
+			`ip saddr 10.217.3.0/24 oifname "eth0" accept`,
+		}},
+		{allowed, []string{
+			nftEstablished,
+			"ip saddr 10.217.3.0/24 ip daddr 10.217.3.0/24 drop",
+			"ip saddr 10.217.3.0/24 ip daddr " +
+				"{ 10.0.0.0/8, 192.168.0.0/16 } drop",
+			"ip saddr 10.217.3.0/24 tcp dport 6881-6889 drop",
+			"ip saddr 10.217.3.0/24 udp dport 6881-6889 drop",
+			`ip saddr 10.217.3.0/24 oifname "eth0" ` +
+				"meta l4proto { tcp, udp } accept",
+			"ip saddr 10.217.3.0/24 drop",
+		}},
+	}
+
+	for _, v := range tests {
+		list := (&nftables{}).forward(v.r)
+		if !reflect.DeepEqual(list, v.expected) {
+			t.Errorf("wrong nftables rules:\n%s",
+				strings.Join(list, "\n"))
+		}
+	}
+}
+
+func TestFiltersForward(t *testing.T) {
+	tests := []struct {
+		chain    string
+		expected bool
+	}{
+		{"-P FORWARD ACCEPT\n", false},
+		{"-P FORWARD DROP\n", true},
+		{"-P FORWARD ACCEPT\n-A FORWARD -j DOCKER-USER\n", true},
+		{"", false},
+	}
+
+	for _, v := range tests {
+		if filtersForward(v.chain) != v.expected {
+			t.Errorf("wrong result for chain: %q", v.chain)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+// +build !linux
+
+package nat
+
+import "fmt"
+
+var errNotSupported = fmt.Errorf("nat is not supported on this system")
+
+// On enables forwarding and applies NAT rules.
+func On(conf *Config) error {
+	return errNotSupported
+}
+
+// Off removes NAT rules and restores forwarding state.
+func Off(conf *Config) error {
+	return errNotSupported
+}
+
+// GetStatus returns forwarding state and applied NAT rules.
+func GetStatus(conf *Config) (*Status, error) {
+	return nil, errNotSupported
+}
+
+// Forwarding returns true if IPv4 forwarding is enabled.
+func Forwarding() (bool, error) {
+	return false, errNotSupported
+}
@@ -0,0 +1,116 @@
+package nat
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// nftables applies rules in a table, which is owned by a tag.
+type nftables struct {
+	path string
+}
+
+func (n *nftables) name() string {
+	return "nftables"
+}
+
+func tableName(tag string) string {
+	return "privatix_" + tag
+}
+
+// apply replaces the owned table atomically. The table is declared before
+// deletion, so that deletion does not fail when the table does not exist.
+func (n *nftables) apply(r *rules) error {
+	table := tableName(r.tag)
+
+	var script bytes.Buffer
+	fmt.Fprintf(&script, "table ip %s\n", table)
+	fmt.Fprintf(&script, "delete table ip %s\n", table)
+	fmt.Fprintf(&script, "table ip %s {\n", table)
+	fmt.Fprintf(&script, "\tchain postrouting {\n")
+	fmt.Fprintf(&script, "\t\ttype nat hook postrouting priority 100;"+
+		" policy accept;\n")
+	fmt.Fprintf(&script, "\t\tip saddr %s oifname %q masquerade"+
+		" comment %q\n", r.subnet, r.egress, ownerComment(r.tag))
+	fmt.Fprintf(&script, "\t}\n")
+	fmt.Fprintf(&script, "\tchain forward {\n")
+	fmt.Fprintf(&script, "\t\ttype filter hook forward priority 0;"+
+		" policy accept;\n")
+	for _, v := range n.forward(r) {
+		fmt.Fprintf(&script, "\t\t%s comment %q\n", v,
+			ownerComment(r.tag))
+	}
+	fmt.Fprintf(&script, "\t}\n")
+	fmt.Fprintf(&script, "}\n")
+
+	cmd := exec.Command(n.path, "-f", "-")
+	cmd.Stdin = &script
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("nft: %v: %s", err,
+			strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// forward returns rules of the forward chain in the order of evaluation.
+func (n *nftables) forward(r *rules) []string {
+	list := []string{fmt.Sprintf("iifname %q ip daddr %s"+
+		" ct state established,related accept", r.egress, r.subnet)}
+	if r.isolation {
+		list = append(list, fmt.Sprintf("ip saddr %s ip daddr %s drop",
+			r.subnet, r.subnet))
+	}
+	if len(r.blocked) != 0 {
+		list = append(list, fmt.Sprintf("ip saddr %s ip daddr { %s } drop",
+			r.subnet, strings.Join(r.blocked, ", ")))
+	}
+	for _, p := range r.ports {
+		for _, proto := range p.protos() {
+			list = append(list, fmt.Sprintf("ip saddr %s %s dport %s drop",
+				r.subnet, proto, p.span("-")))
+		}
+	}
+	if len(r.protocols) == 0 {
+		return append(list, fmt.Sprintf("ip saddr %s oifname %q accept",
+			r.subnet, r.egress))
+	}
+	return append(list,
+		fmt.Sprintf("ip saddr %s oifname %q meta l4proto { %s } accept",
+			r.subnet, r.egress, strings.Join(r.protocols, ", ")),
+		fmt.Sprintf("ip saddr %s drop", r.subnet))
+}
+
+func (n *nftables) remove(tag string) error {
+	if !n.exists(tag) {
+		return nil
+	}
+
+	_, err := run(n.path, "delete", "table", "ip", tableName(tag))
+	return err
+}
+
+func (n *nftables) exists(tag string) bool {
+	_, err := run(n.path, "list", "table", "ip", tableName(tag))
+	return err == nil
+}
+
+func (n *nftables) list(tag string) ([]string, error) {
+	if !n.exists(tag) {
+		return nil, nil
+	}
+
+	out, err := run(n.path, "list", "table", "ip", tableName(tag))
+	if err != nil {
+		return nil, err
+	}
+
+	var list []string
+	for _, line := range strings.Split(out, "\n") {
+		if strings.Contains(line, ownerComment(tag)) {
+			list = append(list, strings.TrimSpace(line))
+		}
+	}
+	return list, nil
+}
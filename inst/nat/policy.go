@@ -0,0 +1,185 @@
+package nat
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Protocols which can be allowed for VPN clients.
+const (
+	ProtoTCP  = "tcp"
+	ProtoUDP  = "udp"
+	ProtoICMP = "icmp"
+)
+
+// Policy is an egress firewall policy for VPN clients.
+type Policy struct {
+	// ClientIsolation blocks traffic between VPN clients.
+	ClientIsolation bool
+	// BlockedNetworks are networks in CIDR notation clients can not reach.
+	BlockedNetworks []string
+	// BlockedPorts are destination ports clients can not reach, e.g.
+	// "25", "tcp/25" or "udp/6881-6889". A port without a protocol is
+	// blocked for tcp and udp.
+	BlockedPorts []string
+	// Protocols are protocols clients can use, all when empty.
+	Protocols []string
+}
+
+// port is a parsed destination port range.
+type port struct {
+	proto string // Empty for tcp and udp.
+	from  uint16
+	to    uint16
+}
+
+// DefaultPolicy returns a policy, which isolates clients, blocks private
+// networks of the host and outgoing SMTP.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		ClientIsolation: true,
+		BlockedNetworks: []string{
+			"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"},
+		BlockedPorts: []string{"tcp/25"},
+	}
+}
+
+// ReadPolicy reads a policy from a json file. A default policy is returned
+// when the file does not exist.
+func ReadPolicy(file string) (*Policy, error) {
+	p := DefaultPolicy()
+
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return p, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(p); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", file, err)
+	}
+	return p, p.Validate()
+}
+
+// WritePolicy writes a policy to a json file.
+func WritePolicy(file string, p *Policy) error {
+	data, err := EncodePolicy(p)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(data)
+	return err
+}
+
+// EncodePolicy returns the policy as it is written to a file.
+func EncodePolicy(p *Policy) ([]byte, error) {
+	return json.MarshalIndent(p, "", "    ")
+}
+
+// Validate checks networks, ports and protocols of the policy.
+func (p *Policy) Validate() error {
+	if _, err := p.networks(); err != nil {
+		return err
+	}
+
+	if _, err := p.ports(); err != nil {
+		return err
+	}
+
+	_, err := p.protocols()
+	return err
+}
+
+func (p *Policy) networks() ([]string, error) {
+	var list []string
+	for _, v := range p.BlockedNetworks {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(v))
+		if err != nil || network.IP.To4() == nil {
+			return nil, fmt.Errorf("invalid blocked network: %s", v)
+		}
+		list = append(list, network.String())
+	}
+	return list, nil
+}
+
+func (p *Policy) ports() ([]port, error) {
+	var list []port
+	for _, v := range p.BlockedPorts {
+		parsed, err := parsePort(v)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *parsed)
+	}
+	return list, nil
+}
+
+func (p *Policy) protocols() ([]string, error) {
+	var list []string
+	for _, v := range p.Protocols {
+		proto := strings.ToLower(strings.TrimSpace(v))
+		switch proto {
+		case ProtoTCP, ProtoUDP, ProtoICMP:
+		default:
+			return nil, fmt.Errorf("unknown protocol: %s", v)
+		}
+		list = append(list, proto)
+	}
+	return list, nil
+}
+
+// parsePort parses a port in "[proto/]port[-port]" format.
+func parsePort(s string) (*port, error) {
+	var p port
+	value := strings.ToLower(strings.TrimSpace(s))
+
+	if i := strings.Index(value, "/"); i >= 0 {
+		p.proto, value = value[:i], value[i+1:]
+		if p.proto != ProtoTCP && p.proto != ProtoUDP {
+			return nil, fmt.Errorf("invalid blocked port: %s", s)
+		}
+	}
+
+	from, to := value, value
+	if i := strings.Index(value, "-"); i >= 0 {
+		from, to = value[:i], value[i+1:]
+	}
+
+	start, err1 := strconv.ParseUint(from, 10, 16)
+	end, err2 := strconv.ParseUint(to, 10, 16)
+	if err1 != nil || err2 != nil || start == 0 || start > end {
+		return nil, fmt.Errorf("invalid blocked port: %s", s)
+	}
+
+	p.from, p.to = uint16(start), uint16(end)
+	return &p, nil
+}
+
+// protos returns protocols the port is blocked for.
+func (p *port) protos() []string {
+	if len(p.proto) != 0 {
+		return []string{p.proto}
+	}
+	return []string{ProtoTCP, ProtoUDP}
+}
+
+// span returns a port range in a given separator format.
+func (p *port) span(sep string) string {
+	if p.from == p.to {
+		return strconv.Itoa(int(p.from))
+	}
+	return fmt.Sprintf("%d%s%d", p.from, sep, p.to)
+}
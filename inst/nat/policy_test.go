@@ -0,0 +1,28 @@
+// +build !nonattest
+
+package nat
+
+import "testing"
+
+func TestParsePort(t *testing.T) {
+	tests := map[string]port{
+		"25":             {from: 25, to: 25},
+		"tcp/25":         {proto: ProtoTCP, from: 25, to: 25},
+		" UDP/6881-6889": {proto: ProtoUDP, from: 6881, to: 6889},
+		"1-65535":        {from: 1, to: 65535},
+	}
+
+	for s, expected := range tests {
+		p, err := parsePort(s)
+		if err != nil || *p != expected {
+			t.Errorf("wrong port of %q: %v, %v", s, p, err)
+		}
+	}
+
+	for _, s := range []string{"", "0", "65536", "icmp/25", "tcp/",
+		"25-", "-25", "30-25", "tcp/25/26", "a"} {
+		if _, err := parsePort(s); err == nil {
+			t.Errorf("invalid port %q accepted", s)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package openvpn
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/privatix/dapp-openvpn/inst/openvpn/path"
+)
+
+const managementTimeout = 10 * time.Second
+
+// Certificate describes an installed certificate.
+type Certificate struct {
+	File      string
+	Subject   string
+	Issuer    string
+	Serial    string
+	IsCA      bool
+	NotBefore time.Time
+	NotAfter  time.Time
+	SHA1      string
+	SHA256    string
+}
+
+func fingerprint(sum []byte) string {
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+func readCertificates(file string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return certs, nil
+}
+
+// keyAlgorithm returns an algorithm of a private key. Keys of installations
+// made before ECDSA support are RSA, certificates issued by them get a key
+// of the configured algorithm.
+func (o *OpenVPN) keyAlgorithm(priv crypto.PrivateKey) string {
+	switch key := priv.(type) {
+	case *ecdsa.PrivateKey:
+		if key.Curve == elliptic.P384() {
+			return ecdsaP384
+		}
+		return ecdsaP256
+	case ed25519.PrivateKey:
+		return ed25519Alg
+	}
+	return o.KeyAlgorithm
+}
+
+func (o *OpenVPN) checkAgent() error {
+	if o.isClient() {
+		return errors.New("certificates are only issued on an agent")
+	}
+	return nil
+}
+
+// Certificates returns the certificate authorities and the server
+// certificate.
+func (o *OpenVPN) Certificates() ([]Certificate, error) {
+	if err := o.checkAgent(); err != nil {
+		return nil, err
+	}
+
+	var result []Certificate
+	for _, file := range []string{path.Config.CACertificate,
+		path.RoleCertificate(o.Role)} {
+		certs, err := readCertificates(filepath.Join(o.Path, file))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, cert := range certs {
+			sha1sum := sha1.Sum(cert.Raw)
+			sha256sum := sha256.Sum256(cert.Raw)
+			result = append(result, Certificate{
+				File:      file,
+				Subject:   cert.Subject.String(),
+				Issuer:    cert.Issuer.String(),
+				Serial:    cert.SerialNumber.String(),
+				IsCA:      cert.IsCA,
+				NotBefore: cert.NotBefore,
+				NotAfter:  cert.NotAfter,
+				SHA1:      fingerprint(sha1sum[:]),
+				SHA256:    fingerprint(sha256sum[:]),
+			})
+		}
+	}
+	return result, nil
+}
+
+// RenewCertificate issues a new server certificate from the current
+// certificate authority. The certificate does not outlive the CA.
+func (o *OpenVPN) RenewCertificate() error {
+	if err := o.checkAgent(); err != nil {
+		return err
+	}
+
+	catls, err := tls.LoadX509KeyPair(
+		filepath.Join(o.Path, path.Config.CACertificate),
+		filepath.Join(o.Path, path.Config.CAKey),
+	)
+	if err != nil {
+		return err
+	}
+	ca, err := x509.ParseCertificate(catls.Certificate[0])
+	if err != nil {
+		return err
+	}
+
+	commonName, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	expired := time.Now().AddDate(o.Validity.Year,
+		o.Validity.Month, o.Validity.Day)
+	if expired.After(ca.NotAfter) {
+		expired = ca.NotAfter
+	}
+
+	return buildCertificate(serverTemplate(commonName, expired),
+		o.keyAlgorithm(catls.PrivateKey), o.Role,
+		filepath.Join(o.Path, "config"))
+}
+
+// RotateCA creates a new certificate authority. The CA file becomes
+// a bundle of the new CA and the CA which issued the current server
+// certificate, so clients configured from the bundle trust the server both
+// before and after the server certificate is renewed from the new CA.
+func (o *OpenVPN) RotateCA() (err error) {
+	if err := o.checkAgent(); err != nil {
+		return err
+	}
+
+	caFile := filepath.Join(o.Path, path.Config.CACertificate)
+	keyFile := filepath.Join(o.Path, path.Config.CAKey)
+
+	oldCA, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return err
+	}
+	oldKey, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+
+	cas, err := readCertificates(caFile)
+	if err != nil {
+		return err
+	}
+	server, err := readCertificates(
+		filepath.Join(o.Path, path.RoleCertificate(o.Role)))
+	if err != nil {
+		return err
+	}
+
+	var issuers []*x509.Certificate
+	for _, ca := range cas {
+		if server[0].CheckSignatureFrom(ca) == nil {
+			issuers = append(issuers, ca)
+		}
+	}
+	if len(issuers) == 0 {
+		return errors.New("server certificate is not issued by the CA")
+	}
+
+	catls, err := tls.X509KeyPair(oldCA, oldKey)
+	if err != nil {
+		return err
+	}
+
+	commonName, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	expired := time.Now().AddDate(o.Validity.Year,
+		o.Validity.Month, o.Validity.Day)
+
+	// Restores the previous CA, if the bundle can not be completed.
+	defer func() {
+		if err == nil {
+			return
+		}
+		ioutil.WriteFile(caFile, oldCA, 0644)
+		ioutil.WriteFile(keyFile, oldKey, 0600)
+	}()
+
+	err = buildCA(caTemplate(commonName, expired),
+		o.keyAlgorithm(catls.PrivateKey), filepath.Join(o.Path, "config"))
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(caFile, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	for _, ca := range issuers {
+		err = pem.Encode(out, &pem.Block{Type: "CERTIFICATE",
+			Bytes: ca.Raw})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configManagementAddr finds the management interface address in
+// a given OpenVPN configuration file.
+func configManagementAddr(config string) (string, error) {
+	args, err := configOption(config, "management")
+	if err != nil {
+		return "", err
+	}
+
+	if len(args) < 2 {
+		return "", errors.New("management interface is not configured")
+	}
+	return net.JoinHostPort(args[0], args[1]), nil
+}
+
+// configOption finds arguments of an option in a given OpenVPN
+// configuration file. It returns no arguments, if the option is not set.
+func configOption(config, name string) ([]string, error) {
+	file, err := os.Open(config)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 0 && fields[0] == name {
+			return fields[1:], nil
+		}
+	}
+	return nil, scanner.Err()
+}
+
+// managementSignal sends a signal to OpenVPN through the management
+// interface.
+func managementSignal(addr, signal string) error {
+	conn, err := net.DialTimeout("tcp", addr, managementTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(managementTimeout))
+
+	if _, err := fmt.Fprintf(conn, "signal %s\n", signal); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case strings.HasPrefix(line, "SUCCESS:"):
+			return nil
+		case strings.HasPrefix(line, "ERROR:"):
+			return errors.New(strings.TrimSpace(line))
+		}
+	}
+}
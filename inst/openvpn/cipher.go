@@ -0,0 +1,66 @@
+package openvpn
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Compression policies, see --allow-compression.
+const (
+	compressionNo   = "no"
+	compressionAsym = "asym"
+	compressionYes  = "yes"
+)
+
+// chacha20 is negotiable since OpenVPN 2.5 only.
+const chacha20 = "CHACHA20-POLY1305"
+
+func (o *OpenVPN) version() version {
+	if len(o.Version) != 0 {
+		if v, err := parseVersion("OpenVPN " + o.Version); err == nil {
+			return v
+		}
+	}
+	return o.detectVersion()
+}
+
+// AtLeast checks that the installed OpenVPN is not older than a given version.
+func (o *OpenVPN) AtLeast(major, minor int) bool {
+	return o.version().AtLeast(major, minor)
+}
+
+// Ciphers returns data channel ciphers to negotiate with clients in the form
+// accepted by --data-ciphers and --ncp-ciphers.
+func (o *OpenVPN) Ciphers() string {
+	modern := o.AtLeast(2, 5)
+
+	var ciphers []string
+	for _, v := range o.DataCiphers {
+		v = strings.ToUpper(strings.TrimSpace(v))
+		if len(v) == 0 || (v == chacha20 && !modern) {
+			continue
+		}
+		ciphers = append(ciphers, v)
+	}
+	return strings.Join(ciphers, ":")
+}
+
+func (o *OpenVPN) configureCiphers() error {
+	switch o.Compression {
+	case compressionNo, compressionAsym, compressionYes:
+	default:
+		return fmt.Errorf("unknown compression policy: %s",
+			o.Compression)
+	}
+
+	if len(o.Ciphers()) == 0 {
+		return fmt.Errorf("no data ciphers to negotiate")
+	}
+
+	if len(o.DataCiphersFallback) == 0 {
+		return fmt.Errorf("no data ciphers fallback")
+	}
+
+	o.Version = o.version().String()
+	return nil
+}
@@ -1,8 +1,10 @@
 package openvpn
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -10,6 +12,7 @@ import (
 
 	"github.com/takama/daemon"
 
+	adapter "github.com/privatix/dapp-openvpn/adapter/config"
 	"github.com/privatix/dapp-openvpn/inst/openvpn/path"
 )
 
@@ -25,12 +28,23 @@ func NewDappVPN() *DappVPN {
 
 // Configurate configurates dappvpn config files.
 func (d *DappVPN) Configurate(o *OpenVPN) error {
+	data, err := d.config(o)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(
+		filepath.Join(o.Path, path.Config.AdapterConfig), data, 0644)
+}
+
+// config returns the dappvpn configuration with installation parameters.
+func (d *DappVPN) config(o *OpenVPN) ([]byte, error) {
 	p := o.Path
 	configFile := filepath.Join(p, path.Config.AdapterConfig)
 
 	read, err := os.Open(configFile)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer read.Close()
 
@@ -59,37 +73,45 @@ func (d *DappVPN) Configurate(o *OpenVPN) error {
 	}
 	maps["Pusher.CaCertPath"] = filepath.Join(p, path.Config.CACertificate)
 	maps["Pusher.ConfigPath"] = filepath.Join(p, path.RoleConfig(o.Role))
+	maps["Pusher.TLSKeyPath"] = filepath.Join(p, path.Config.TLSKey)
+	maps["Pusher.TLSKeyMode"] = o.TLSMode
+	maps["Pusher.ServerCertPath"] = filepath.Join(p,
+		path.RoleCertificate(o.Role))
+	if !o.isClient() {
+		maps["TC.Subnet"] = o.Subnet
+	}
 
 	addr := fmt.Sprintf("%s:%v", o.Managment.IP, o.Managment.Port)
 	maps["Monitor.Addr"] = addr
 	addr, err = sessAddr(filepath.Join(p, path.Config.DappCtrlConfig))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	maps["Sess.Endpoint"] = fmt.Sprintf("ws://%s/ws", addr)
 	maps["ChannelDir"] = filepath.Join(p, path.Config.DataDir)
 
 	if err := setConfigurationValues(jsonMap, maps); err != nil {
-		return err
+		return nil, err
 	}
 
-	write, err := os.Create(configFile)
-	if err != nil {
-		return err
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(jsonMap); err != nil {
+		return nil, err
 	}
-	defer write.Close()
 
-	return json.NewEncoder(write).Encode(jsonMap)
+	if _, err := adapter.Parse(buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("invalid adapter config: %v", err)
+	}
+	return buf.Bytes(), nil
 }
 
 // InstallService installs a dappvpn service.
 func (d *DappVPN) InstallService(role, dir string) (string, error) {
-	d.Service = serviceName(path.Config.DVPN, dir)
+	d.Service = adapterServiceName(dir)
 	descr := fmt.Sprintf("Privatix %s dappvpn %s", role, hash(dir))
 	var dependencies []string
 
 	if strings.EqualFold(runtime.GOOS, "windows") {
-		d.Service = fmt.Sprintf("Privatix DappVPN %s", hash(dir))
 		if strings.EqualFold(role, "server") {
 			dependencies = []string{
 				fmt.Sprintf("Privatix_OpenVPN_%s", hash(dir))}
@@ -112,6 +134,13 @@ func (d *DappVPN) InstallService(role, dir string) (string, error) {
 	return service.Install("run-adapter", "-workdir", dir)
 }
 
+func adapterServiceName(dir string) string {
+	if strings.EqualFold(runtime.GOOS, "windows") {
+		return fmt.Sprintf("Privatix DappVPN %s", hash(dir))
+	}
+	return serviceName(path.Config.DVPN, dir)
+}
+
 // StartService starts dappvpn service.
 func (d *DappVPN) StartService() (string, error) {
 	service, err := daemon.New(d.Service, "")
@@ -0,0 +1,250 @@
+package openvpn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/privatix/dapp-openvpn/inst/nat"
+	"github.com/privatix/dapp-openvpn/inst/openvpn/path"
+)
+
+// Results of diagnostics.
+const (
+	DiagnosisOK      = "ok"
+	DiagnosisWarning = "warning"
+	DiagnosisFailed  = "failed"
+	DiagnosisSkipped = "skipped"
+)
+
+// dnsCheckHost is resolved to check DNS.
+const dnsCheckHost = "example.com"
+
+// Diagnosis is a result of a diagnostic check.
+type Diagnosis struct {
+	Check  string
+	Result string
+	Detail string
+	// Fix is a suggested fix of a problem.
+	Fix string
+}
+
+// Doctor runs diagnostics of the installation.
+func (o *OpenVPN) Doctor() []Diagnosis {
+	result := []Diagnosis{
+		o.diagnoseForwarding(),
+		o.diagnoseTun(),
+		o.diagnoseOpenVPN(),
+		diagnoseDNS(),
+	}
+	result = append(result, o.diagnosePorts()...)
+	return append(result, o.diagnoseSessServer())
+}
+
+func (o *OpenVPN) diagnoseForwarding() Diagnosis {
+	d := Diagnosis{Check: "ip forwarding"}
+	if o.isClient() {
+		d.Result = DiagnosisSkipped
+		d.Detail = "not used by client"
+		return d
+	}
+
+	var enabled bool
+	var err error
+	switch runtime.GOOS {
+	case "darwin":
+		var out []byte
+		out, err = exec.Command("/usr/sbin/sysctl", "-n",
+			"net.inet.ip.forwarding").Output()
+		enabled = strings.TrimSpace(string(out)) == "1"
+	case "windows":
+		d.Result = DiagnosisSkipped
+		d.Detail = "internet connection sharing is used"
+		return d
+	default:
+		enabled, err = nat.Forwarding()
+	}
+
+	switch {
+	case err != nil:
+		d.Result = DiagnosisFailed
+		d.Detail = err.Error()
+	case !enabled:
+		d.Result = DiagnosisFailed
+		d.Detail = "forwarding is disabled"
+		d.Fix = "run 'installer nat on' or restart the NAT service " +
+			serviceName("nat", o.Path)
+	default:
+		d.Result = DiagnosisOK
+		d.Detail = "forwarding is enabled"
+	}
+	return d
+}
+
+func (o *OpenVPN) diagnoseTun() Diagnosis {
+	d := Diagnosis{Check: "tun device"}
+	switch runtime.GOOS {
+	case "linux":
+		if _, err := os.Stat("/dev/net/tun"); err != nil {
+			d.Result = DiagnosisFailed
+			d.Detail = err.Error()
+			d.Fix = "load the tun module with 'modprobe tun', in" +
+				" a container pass /dev/net/tun device and" +
+				" NET_ADMIN capability"
+			return d
+		}
+		d.Detail = "/dev/net/tun"
+	case "windows":
+		if len(o.Tap.DeviceID) == 0 {
+			d.Result = DiagnosisFailed
+			d.Detail = "tap interface is not installed"
+			d.Fix = "remove and install the product again"
+			return d
+		}
+		d.Detail = o.Tap.DeviceID
+	default:
+		d.Detail = "utun is built in"
+	}
+	d.Result = DiagnosisOK
+	return d
+}
+
+func (o *OpenVPN) diagnoseOpenVPN() Diagnosis {
+	d := Diagnosis{Check: "openvpn binary"}
+
+	bin := o.openvpnBinary()
+	// OpenVPN exits with a non-zero code after printing its version.
+	out, err := exec.Command(bin, "--version").Output()
+	if len(out) != 0 || err == nil {
+		var v version
+		v, err = parseVersion(string(out))
+		if err == nil {
+			return diagnoseVersion(d, bin, v)
+		}
+	}
+	d.Result = DiagnosisFailed
+	d.Detail = fmt.Sprintf("%s: %v", bin, err)
+	d.Fix = "install OpenVPN 2.4 or newer"
+	return d
+}
+
+func diagnoseVersion(d Diagnosis, bin string, v version) Diagnosis {
+	d.Detail = fmt.Sprintf("%s %s", bin, v)
+	if !v.AtLeast(2, 4) {
+		d.Result = DiagnosisWarning
+		d.Fix = "upgrade OpenVPN to 2.4 or newer"
+		return d
+	}
+	d.Result = DiagnosisOK
+	return d
+}
+
+func diagnoseDNS() Diagnosis {
+	d := Diagnosis{Check: "dns"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, dnsCheckHost)
+	if err != nil {
+		d.Result = DiagnosisFailed
+		d.Detail = err.Error()
+		d.Fix = "check name servers of the system"
+		return d
+	}
+
+	d.Result = DiagnosisOK
+	d.Detail = fmt.Sprintf("%s resolved to %s", dnsCheckHost,
+		strings.Join(addrs, ", "))
+	return d
+}
+
+func (o *OpenVPN) diagnosePorts() []Diagnosis {
+	var result []Diagnosis
+	for _, p := range o.ports() {
+		d := Diagnosis{
+			Check:  fmt.Sprintf("%s port", p.Name),
+			Detail: fmt.Sprintf("%s %s", p.Proto, p.Addr),
+		}
+		if p.Listening {
+			d.Result = DiagnosisOK
+		} else if p.Name == managementPort {
+			d.Result = DiagnosisWarning
+			d.Detail += " is not listening, the adapter may be" +
+				" attached"
+		} else {
+			d.Result = DiagnosisFailed
+			d.Detail += " is not listening"
+			d.Fix = "run 'installer start', check openvpn log" +
+				" for errors"
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+func (o *OpenVPN) diagnoseSessServer() Diagnosis {
+	d := Diagnosis{Check: "session server"}
+
+	addr, err := o.sessServerAddr()
+	if err != nil {
+		d.Result = DiagnosisFailed
+		d.Detail = err.Error()
+		d.Fix = "check Sess.Endpoint in " + path.Config.AdapterConfig
+		return d
+	}
+
+	d.Detail = addr
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		d.Result = DiagnosisFailed
+		d.Detail = err.Error()
+		d.Fix = "start dappctrl, check Sess.Addr of its configuration"
+		return d
+	}
+	conn.Close()
+
+	d.Result = DiagnosisOK
+	d.Detail = fmt.Sprintf("%s connected in %v", addr,
+		time.Since(start).Round(time.Millisecond))
+	return d
+}
+
+// sessServerAddr returns the session server address from the adapter
+// config.
+func (o *OpenVPN) sessServerAddr() (string, error) {
+	data, err := ioutil.ReadFile(
+		filepath.Join(o.Path, path.Config.AdapterConfig))
+	if err != nil {
+		return "", err
+	}
+
+	var conf struct {
+		Sess struct {
+			Endpoint string
+		}
+	}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(conf.Sess.Endpoint)
+	if err != nil {
+		return "", err
+	}
+	if len(u.Host) == 0 {
+		return "", fmt.Errorf("invalid session server endpoint: %s",
+			conf.Sess.Endpoint)
+	}
+	return u.Host, nil
+}
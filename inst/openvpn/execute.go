@@ -7,15 +7,20 @@ import (
 	"path/filepath"
 	"runtime"
 	"syscall"
+	"time"
 
 	"github.com/privatix/dapp-openvpn/inst/openvpn/path"
 )
 
+// stopTimeout is a time to wait for a stopped process to exit.
+const stopTimeout = 10 * time.Second
+
 type execute struct {
 	Path    string
 	Role    string
 	Type    string
 	Process *os.Process
+	exited  chan struct{}
 }
 
 // Start is a start method of executable service.
@@ -43,13 +48,54 @@ func run(e *execute) error {
 	args = append(args, "--config", config)
 	cmd := exec.Command(vpn, args...)
 
+	e.exited = make(chan struct{})
 	if err := cmd.Start(); err != nil {
 		return err
 	}
 
 	e.Process = cmd.Process
 
-	return cmd.Wait()
+	err := cmd.Wait()
+	close(e.exited)
+	return err
+}
+
+// wait waits for the process to exit.
+func (e *execute) wait() bool {
+	select {
+	case <-e.exited:
+		return true
+	case <-time.After(stopTimeout):
+		return false
+	}
+}
+
+// stop gracefully stops the process. OpenVPN is asked to exit through
+// the management interface. If the process does not exit in time, it is
+// terminated and then killed.
+func (e *execute) stop() {
+	if e.Process == nil {
+		return
+	}
+
+	if e.Type == path.Config.OVPN {
+		addr, err := configManagementAddr(
+			filepath.Join(e.Path, path.VPNConfig(e.Type, e.Role)))
+		if err == nil {
+			err = managementSignal(addr, "SIGTERM")
+		}
+		if err == nil && e.wait() {
+			return
+		}
+	}
+
+	// Signals other than kill are not supported on Windows.
+	if err := e.Process.Signal(syscall.SIGTERM); err == nil && e.wait() {
+		return
+	}
+
+	e.Process.Kill()
+	<-e.exited
 }
 
 // Run is a run method of executable service.
@@ -71,9 +117,7 @@ func (e *execute) Run() {
 	for {
 		select {
 		case <-interrupt:
-			if e.Process != nil {
-				e.Process.Kill()
-			}
+			e.stop()
 			break
 		}
 	}
@@ -81,7 +125,5 @@ func (e *execute) Run() {
 
 // Stop is a stop method of executable service.
 func (e *execute) Stop() {
-	if e.Process != nil {
-		e.Process.Kill()
-	}
+	e.stop()
 }
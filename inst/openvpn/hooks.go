@@ -0,0 +1,50 @@
+package openvpn
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Hooks has commands executed before and after the installer steps.
+// The keys are step names, the values are a command and its arguments.
+type Hooks struct {
+	Before map[string][]string
+	After  map[string][]string
+}
+
+// Hook stages.
+const (
+	HookBefore = "before"
+	HookAfter  = "after"
+)
+
+// RunHook executes the command configured for the step and the stage.
+func (o *OpenVPN) RunHook(stage, step string) error {
+	if o.Hooks == nil {
+		return nil
+	}
+
+	hooks := o.Hooks.Before
+	if stage == HookAfter {
+		hooks = o.Hooks.After
+	}
+
+	args := hooks[step]
+	if len(args) == 0 {
+		return nil
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"PRIVATIX_WORKDIR="+o.Path,
+		"PRIVATIX_ROLE="+o.Role,
+		"PRIVATIX_STEP="+step,
+		"PRIVATIX_STAGE="+stage)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s '%s' hook failed: %v: %s", stage, step,
+			err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
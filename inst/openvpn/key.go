@@ -1,97 +1,149 @@
 package openvpn
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/rsa"
+	"crypto/sha1"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
+	"fmt"
 	"math"
 	"math/big"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
+// Key algorithms of the certificates.
+const (
+	ecdsaP256  = "ecdsa-p256"
+	ecdsaP384  = "ecdsa-p384"
+	ed25519Alg = "ed25519"
+)
+
 func randomNumber() int64 {
 	r, _ := rand.Int(rand.Reader, big.NewInt(math.MaxInt64))
 	return r.Int64()
 }
 
-func buildServerCertificate(path string, expired time.Time) error {
-	commonName, err := os.Hostname()
+func validKeyAlgorithm(alg string) bool {
+	switch strings.ToLower(alg) {
+	case ecdsaP256, ecdsaP384, ed25519Alg:
+		return true
+	}
+	return false
+}
+
+// ecdhCurve returns a curve for ECDH key exchange matching a key algorithm.
+// For Ed25519 OpenSSL chooses a group by itself.
+func ecdhCurve(alg string) string {
+	switch strings.ToLower(alg) {
+	case ecdsaP256:
+		return "prime256v1"
+	case ecdsaP384:
+		return "secp384r1"
+	}
+	return ""
+}
+
+func generateKey(alg string) (crypto.Signer, error) {
+	switch strings.ToLower(alg) {
+	case ecdsaP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case ecdsaP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case ed25519Alg:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	}
+	return nil, fmt.Errorf("unknown key algorithm: %s", alg)
+}
+
+// subjectKeyID computes a key identifier as described in RFC 5280, 4.2.1.2:
+// SHA-1 hash of the subject public key bit string.
+func subjectKeyID(pub crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	ca := &x509.Certificate{
-		SerialNumber: big.NewInt(randomNumber()),
-		Subject:      pkix.Name{CommonName: commonName},
-		NotBefore:    time.Now(),
-		NotAfter:     expired,
-		IsCA:         true,
-		BasicConstraintsValid: true,
-		ExtKeyUsage: []x509.ExtKeyUsage{
-			x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
 	}
 
-	if err := buildCA(ca, path); err != nil {
-		return err
+	id := sha1.Sum(info.PublicKey.Bytes)
+	return id[:], nil
+}
+
+func caTemplate(commonName string, expired time.Time) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber:          big.NewInt(randomNumber()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now(),
+		NotAfter:              expired,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
 	}
+}
 
-	cert := &x509.Certificate{
+func serverTemplate(commonName string, expired time.Time) *x509.Certificate {
+	return &x509.Certificate{
 		SerialNumber: big.NewInt(randomNumber()),
 		Subject:      pkix.Name{CommonName: commonName},
 		NotBefore:    time.Now(),
 		NotAfter:     expired,
-		SubjectKeyId: []byte{1, 2, 3, 4, 6},
-		ExtKeyUsage: []x509.ExtKeyUsage{
-			x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage: x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
 	}
-
-	return buildCertificate(cert, "server", path)
 }
 
-func buildCA(ca *x509.Certificate, path string) error {
-	priv, err := rsa.GenerateKey(rand.Reader, 4096)
+func buildServerCertificate(path, alg string, expired time.Time) error {
+	commonName, err := os.Hostname()
 	if err != nil {
 		return err
 	}
 
-	bytes, err := x509.CreateCertificate(rand.Reader, ca, ca,
-		&priv.PublicKey, priv)
-	if err != nil {
+	if err := buildCA(caTemplate(commonName, expired), alg, path); err != nil {
 		return err
 	}
 
-	// Public key.
-	certOut, err := os.Create(filepath.Join(path, "ca.crt"))
+	return buildCertificate(serverTemplate(commonName, expired),
+		alg, "server", path)
+}
+
+func buildCA(ca *x509.Certificate, alg, path string) error {
+	priv, err := generateKey(alg)
 	if err != nil {
 		return err
 	}
-	defer certOut.Close()
 
-	if err := pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE",
-		Bytes: bytes}); err != nil {
+	if ca.SubjectKeyId, err = subjectKeyID(priv.Public()); err != nil {
 		return err
 	}
 
-	// Private key.
-	keyOut, err := os.OpenFile(filepath.Join(path, "ca.key"),
-		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	bytes, err := x509.CreateCertificate(rand.Reader, ca, ca,
+		priv.Public(), priv)
 	if err != nil {
 		return err
 	}
-	defer keyOut.Close()
 
-	return pem.Encode(keyOut, &pem.Block{Type: "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+	return writeKeyPair(bytes, priv,
+		filepath.Join(path, "ca.crt"), filepath.Join(path, "ca.key"))
 }
 
-func buildCertificate(cert *x509.Certificate, name, path string) error {
+func buildCertificate(cert *x509.Certificate, alg, name, path string) error {
 	// Load CA.
 	catls, err := tls.LoadX509KeyPair(
 		filepath.Join(path, "ca.crt"),
@@ -105,34 +157,57 @@ func buildCertificate(cert *x509.Certificate, name, path string) error {
 		return err
 	}
 
-	priv, err := rsa.GenerateKey(rand.Reader, 4096)
+	priv, err := generateKey(alg)
 	if err != nil {
 		return err
 	}
+
+	if cert.SubjectKeyId, err = subjectKeyID(priv.Public()); err != nil {
+		return err
+	}
+
+	// The server and the CA share a subject, so AuthorityKeyId is not
+	// filled in automatically.
+	cert.AuthorityKeyId = ca.SubjectKeyId
+
 	// Sign the certificate.
 	bytes, err := x509.CreateCertificate(rand.Reader, cert, ca,
-		&priv.PublicKey, catls.PrivateKey)
+		priv.Public(), catls.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	return writeKeyPair(bytes, priv, filepath.Join(path, name+".crt"),
+		filepath.Join(path, name+".key"))
+}
+
+// writeKeyPair writes a certificate and its private key in PKCS #8 form.
+func writeKeyPair(cert []byte, priv crypto.Signer,
+	certFile, keyFile string) error {
+	key, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return err
+	}
 
 	// Public key.
-	certOut, err := os.Create(filepath.Join(path, name+".crt"))
+	certOut, err := os.Create(certFile)
 	if err != nil {
 		return err
 	}
 	defer certOut.Close()
 
 	if err := pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE",
-		Bytes: bytes}); err != nil {
+		Bytes: cert}); err != nil {
 		return err
 	}
 
 	// Private key.
-	keyOut, err := os.OpenFile(filepath.Join(path, name+".key"),
+	keyOut, err := os.OpenFile(keyFile,
 		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
 	}
 	defer keyOut.Close()
 
-	return pem.Encode(keyOut, &pem.Block{Type: "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+	return pem.Encode(keyOut, &pem.Block{Type: "PRIVATE KEY", Bytes: key})
 }
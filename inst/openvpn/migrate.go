@@ -0,0 +1,170 @@
+package openvpn
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	adapter "github.com/privatix/dapp-openvpn/adapter/config"
+	"github.com/privatix/dapp-openvpn/inst/nat"
+	"github.com/privatix/dapp-openvpn/inst/openvpn/path"
+	"github.com/privatix/dapp-openvpn/inst/pipeline"
+)
+
+// migration upgrades an installation from one schema version of
+// the environment configs to the next one.
+type migration struct {
+	from  string
+	to    string
+	apply func(*OpenVPN) error
+	plan  func(*OpenVPN) ([]pipeline.Change, error)
+}
+
+// migrations are ordered by version, the last one upgrades to
+// env.Schema.
+var migrations = []migration{
+	{"1.0", "1.1", (*OpenVPN).migrateFirewall, (*OpenVPN).planFirewall},
+}
+
+// pendingMigrations returns migrations needed by the schema version.
+func pendingMigrations(schema string) ([]migration, error) {
+	if len(schema) == 0 {
+		schema = migrations[0].from
+	}
+
+	var result []migration
+	for _, m := range migrations {
+		if m.from == schema {
+			result = append(result, m)
+			schema = m.to
+		}
+	}
+
+	if schema != migrations[len(migrations)-1].to {
+		return nil, fmt.Errorf("unknown config schema: %s", schema)
+	}
+	return result, nil
+}
+
+// Migrate upgrades the installation configs made with the schema
+// version. It returns the resulting schema version.
+func (o *OpenVPN) Migrate(schema string) (string, error) {
+	pending, err := pendingMigrations(schema)
+	if err != nil {
+		return schema, err
+	}
+
+	for _, m := range pending {
+		if err := m.apply(o); err != nil {
+			return schema, fmt.Errorf("failed to migrate config"+
+				" from %s to %s: %v", m.from, m.to, err)
+		}
+		schema = m.to
+	}
+
+	file, data, err := o.migratedAdapterConfig()
+	if err != nil {
+		return schema, err
+	}
+	return schema, ioutil.WriteFile(file, data, 0644)
+}
+
+// PlanMigrate describes the changes of Migrate.
+func (o *OpenVPN) PlanMigrate(schema string) ([]pipeline.Change, error) {
+	pending, err := pendingMigrations(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []pipeline.Change
+	for _, m := range pending {
+		c, err := m.plan(o)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, c...)
+	}
+
+	file, data, err := o.migratedAdapterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if c := pipeline.FileChange(file, data); c.Action != "keep" {
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// migratedAdapterConfig returns the adapter config upgraded to the version
+// of the adapter.
+func (o *OpenVPN) migratedAdapterConfig() (string, []byte, error) {
+	file := filepath.Join(o.Path, path.Config.AdapterConfig)
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", nil, err
+	}
+
+	raw := make(map[string]interface{})
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return "", nil, fmt.Errorf("invalid adapter config: %v", err)
+	}
+
+	if err := adapter.Migrate(raw); err != nil {
+		return "", nil, fmt.Errorf("failed to migrate adapter"+
+			" config: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(raw); err != nil {
+		return "", nil, err
+	}
+	return file, buf.Bytes(), nil
+}
+
+// migrateFirewall stores the tunnel subnet and the default egress
+// firewall policy of installations made before they were introduced.
+func (o *OpenVPN) migrateFirewall() error {
+	if o.isClient() {
+		return nil
+	}
+
+	if err := o.loadSubnet(); err != nil {
+		return err
+	}
+
+	file := filepath.Join(o.Path, path.Config.FirewallConfig)
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		return err
+	}
+	return o.writeFirewallPolicy()
+}
+
+func (o *OpenVPN) planFirewall() ([]pipeline.Change, error) {
+	if o.isClient() {
+		return nil, nil
+	}
+
+	if err := o.loadSubnet(); err != nil {
+		return nil, err
+	}
+
+	if runtime.GOOS != "linux" {
+		return nil, nil
+	}
+
+	file := filepath.Join(o.Path, path.Config.FirewallConfig)
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	data, err := nat.EncodePolicy(nat.DefaultPolicy())
+	if err != nil {
+		return nil, err
+	}
+	return []pipeline.Change{pipeline.FileChange(file, data)}, nil
+}
@@ -221,6 +221,8 @@ func copyFile(src, dst string) error {
 	return os.Chmod(dst, srcinfo.Mode())
 }
 
+// merge updates json files of dst with the structure of the same files
+// of src, keeping the values of dst.
 func merge(src, dst string) error {
 	var err error
 	var fds []os.FileInfo
@@ -235,17 +237,23 @@ func merge(src, dst string) error {
 		srcfp := filepath.Join(src, fd.Name())
 		dstfp := filepath.Join(dst, fd.Name())
 
-		if err = mergeJSONFile(srcfp, dstfp); err != nil {
+		data, err := mergedJSONFile(srcfp, dstfp)
+		if err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(dstfp, data, 0644); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func mergeJSONFile(dstFile, srcFile string) error {
+// mergedJSONFile returns the content of dstFile with values from srcFile.
+func mergedJSONFile(dstFile, srcFile string) ([]byte, error) {
 	dstRead, err := os.Open(dstFile)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer dstRead.Close()
 
@@ -254,7 +262,7 @@ func mergeJSONFile(dstFile, srcFile string) error {
 
 	srcRead, err := os.Open(srcFile)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer srcRead.Close()
 
@@ -263,13 +271,17 @@ func mergeJSONFile(dstFile, srcFile string) error {
 
 	mergeJSON(dstMap, srcMap)
 
-	write, err := os.Create(dstFile)
-	if err != nil {
-		return err
+	// A version describes the values, so the values of an older version
+	// are migrated instead of being labeled with the new one.
+	if _, ok := srcMap["Version"]; !ok {
+		delete(dstMap, "Version")
 	}
-	defer write.Close()
 
-	return json.NewEncoder(write).Encode(dstMap)
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(dstMap); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
 func mergeJSON(dstMap, srcMap map[string]interface{}) {
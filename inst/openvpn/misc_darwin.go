@@ -2,9 +2,12 @@ package openvpn
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"text/template"
 
 	"github.com/privatix/dapp-openvpn/inst/openvpn/path"
@@ -19,13 +22,73 @@ func setRegValue(guid, name string) error {
 	return nil
 }
 
+// localRoutes returns IPv4 routes of the routing table.
+func localRoutes() ([]*net.IPNet, error) {
+	out, err := exec.Command("/usr/sbin/netstat", "-rn", "-f", "inet").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []*net.IPNet
+	for _, line := range strings.Split(string(out), "\n") {
+		// Destination Gateway Flags Netif Expire
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if route := parseDestination(fields[0]); route != nil {
+			routes = append(routes, route)
+		}
+	}
+	return routes, nil
+}
+
+// parseDestination parses a route destination printed by netstat, which
+// omits trailing zero octets, e.g. "10.211/16" or "192.168.1".
+func parseDestination(dst string) *net.IPNet {
+	addr := dst
+	var prefix int
+	if i := strings.Index(dst, "/"); i >= 0 {
+		addr = dst[:i]
+		var err error
+		if prefix, err = strconv.Atoi(dst[i+1:]); err != nil {
+			return nil
+		}
+	}
+
+	octets := strings.Split(addr, ".")
+	if len(octets) > net.IPv4len {
+		return nil
+	}
+	if prefix == 0 {
+		prefix = 8 * len(octets)
+	}
+	for len(octets) < net.IPv4len {
+		octets = append(octets, "0")
+	}
+
+	ip := net.ParseIP(strings.Join(octets, ".")).To4()
+	if ip == nil || prefix > 32 {
+		return nil
+	}
+
+	mask := net.CIDRMask(prefix, 32)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
+
+// removeNatRules does nothing, NAT rules are removed by RemoveConfig.
+func removeNatRules(p string) error {
+	return nil
+}
+
 func daemonPath(name string) string {
 	return filepath.Join("/Library/LaunchDaemons", name+".plist")
 }
 
 // createNatRules creates daemon on Mac, which configures NAT rules.
-func createNatRules(p, server string, port int) error {
-	name := serviceName("nat", p)
+func createNatRules(o *OpenVPN) error {
+	name := serviceName("nat", o.Path)
 	file, err := os.Create(daemonPath(name))
 	if err != nil {
 		return err
@@ -43,21 +106,23 @@ func createNatRules(p, server string, port int) error {
 	}
 
 	type natRule struct {
-		Name   string
-		Script string
-		Server string
-		Port   int
+		Name     string
+		Script   string
+		Subnet   string
+		ServerIP string
+		Port     int
 	}
 
-	script := filepath.Join(p, path.Config.NatScript)
+	script := filepath.Join(o.Path, path.Config.NatScript)
 	if err := os.Chmod(script, 0777); err != nil {
 		return err
 	}
 	d := &natRule{
-		Name:   name,
-		Script: script,
-		Server: server,
-		Port:   port,
+		Name:     name,
+		Script:   script,
+		Subnet:   o.Subnet,
+		ServerIP: o.ServerIP(),
+		Port:     o.Host.Port,
 	}
 	if err := templ.Execute(file, &d); err != nil {
 		return err
@@ -1,13 +1,16 @@
 package openvpn
 
 import (
+	"bufio"
+	"encoding/hex"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"text/template"
 
-	"github.com/privatix/dapp-openvpn/inst/openvpn/path"
 	"github.com/privatix/dapp-openvpn/statik"
 )
 
@@ -19,13 +22,52 @@ func setRegValue(guid, name string) error {
 	return nil
 }
 
+// localRoutes returns IPv4 routes of the main routing table.
+func localRoutes() ([]*net.IPNet, error) {
+	file, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var routes []*net.IPNet
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+
+		dst, err1 := hex.DecodeString(fields[1])
+		mask, err2 := hex.DecodeString(fields[7])
+		if err1 != nil || err2 != nil ||
+			len(dst) != net.IPv4len || len(mask) != net.IPv4len {
+			continue
+		}
+
+		// Addresses are in host byte order, which is little endian.
+		reverse(dst)
+		reverse(mask)
+		routes = append(routes, &net.IPNet{IP: dst, Mask: mask})
+	}
+	return routes, scanner.Err()
+}
+
+func reverse(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
+
 func daemonPath(name string) string {
 	return filepath.Join("/etc/systemd/system/", name+".service")
 }
 
-// createNatRules creates daemon on linux, which configures NAT rules.
-func createNatRules(p, server string, port int) error {
-	name := serviceName("nat", p)
+// createNatRules creates daemon on linux, which runs "installer nat on" to
+// configure forwarding and NAT rules and "installer nat off" to remove them.
+func createNatRules(o *OpenVPN) error {
+	name := serviceName("nat", o.Path)
 	file, err := os.Create(daemonPath(name))
 	if err != nil {
 		return err
@@ -43,23 +85,44 @@ func createNatRules(p, server string, port int) error {
 	}
 
 	type natRule struct {
-		Name   string
-		Script string
-		Server string
+		Name      string
+		Installer string
+		Path      string
 	}
 
-	script := filepath.Join(p, path.Config.NatScript)
-	if err := os.Chmod(script, 0777); err != nil {
+	installer, err := os.Executable()
+	if err != nil {
 		return err
 	}
 	d := &natRule{
-		Name:   name,
-		Script: script,
-		Server: server,
+		Name:      name,
+		Installer: installer,
+		Path:      o.Path,
 	}
 	if err := templ.Execute(file, &d); err != nil {
 		return err
 	}
 
-	return exec.Command("systemctl", "enable", daemonPath(name)).Run()
+	if err := exec.Command("systemctl", "enable",
+		daemonPath(name)).Run(); err != nil {
+		return err
+	}
+	return exec.Command("systemctl", "start", name).Run()
+}
+
+// removeNatRules stops and removes the NAT daemon.
+func removeNatRules(p string) error {
+	name := serviceName("nat", p)
+	if _, err := os.Stat(daemonPath(name)); os.IsNotExist(err) {
+		return nil
+	}
+
+	if err := exec.Command("systemctl", "stop", name).Run(); err != nil {
+		return err
+	}
+
+	if err := exec.Command("systemctl", "disable", name).Run(); err != nil {
+		return err
+	}
+	return os.Remove(daemonPath(name))
 }
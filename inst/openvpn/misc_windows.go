@@ -2,6 +2,9 @@ package openvpn
 
 import (
 	"fmt"
+	"net"
+	"os/exec"
+	"strings"
 
 	"golang.org/x/sys/windows/registry"
 )
@@ -24,7 +27,41 @@ func setRegValue(guid, name string) error {
 	return key.SetStringValue("Name", name)
 }
 
-func createNatRules(p, server string, port int) error {
+func createNatRules(o *OpenVPN) error {
+	return nil
+}
+
+// localRoutes returns IPv4 routes of the routing table.
+func localRoutes() ([]*net.IPNet, error) {
+	out, err := exec.Command("route", "print", "-4").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []*net.IPNet
+	for _, line := range strings.Split(string(out), "\n") {
+		// Network Destination Netmask Gateway Interface Metric
+		fields := strings.Fields(line)
+		if len(fields) != 5 {
+			continue
+		}
+
+		dst := net.ParseIP(fields[0]).To4()
+		mask := net.ParseIP(fields[1]).To4()
+		if dst == nil || mask == nil {
+			continue
+		}
+
+		if _, bits := net.IPMask(mask).Size(); bits == 32 {
+			routes = append(routes,
+				&net.IPNet{IP: dst, Mask: net.IPMask(mask)})
+		}
+	}
+	return routes, nil
+}
+
+// removeNatRules does nothing, there are no NAT rules on windows.
+func removeNatRules(p string) error {
 	return nil
 }
 
@@ -0,0 +1,104 @@
+package openvpn
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"runtime"
+
+	"github.com/privatix/dapp-openvpn/inst/nat"
+	"github.com/privatix/dapp-openvpn/inst/openvpn/path"
+)
+
+// loadSubnet reads the tunnel subnet from the server configuration, if it's
+// unknown. Installations made before the subnet was stored need it.
+func (o *OpenVPN) loadSubnet() error {
+	if len(o.Subnet) != 0 {
+		return nil
+	}
+
+	args, err := configOption(
+		filepath.Join(o.Path, path.RoleConfig(o.Role)), "server")
+	if err != nil {
+		return err
+	}
+
+	if len(args) < 2 {
+		return fmt.Errorf("server subnet is not configured")
+	}
+
+	ones, bits := net.IPMask(net.ParseIP(args[1]).To4()).Size()
+	if bits == 0 {
+		return fmt.Errorf("invalid server subnet mask: %s", args[1])
+	}
+
+	o.Subnet = fmt.Sprintf("%s/%d", args[0], ones)
+	return nil
+}
+
+// writeFirewallPolicy validates the egress firewall policy and saves it
+// to apply on every start of NAT. The policy is applied on linux only.
+func (o *OpenVPN) writeFirewallPolicy() error {
+	if o.Firewall == nil {
+		o.Firewall = nat.DefaultPolicy()
+	}
+
+	if err := o.Firewall.Validate(); err != nil {
+		return err
+	}
+
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+
+	return nat.WritePolicy(
+		filepath.Join(o.Path, path.Config.FirewallConfig), o.Firewall)
+}
+
+func (o *OpenVPN) natConfig() (*nat.Config, error) {
+	if err := o.loadSubnet(); err != nil {
+		return nil, err
+	}
+
+	policy, err := nat.ReadPolicy(
+		filepath.Join(o.Path, path.Config.FirewallConfig))
+	if err != nil {
+		return nil, err
+	}
+	o.Firewall = policy
+
+	return &nat.Config{
+		Tag:       hash(o.Path),
+		Subnet:    o.Subnet,
+		StateFile: filepath.Join(o.Path, path.Config.NatState),
+		Policy:    policy,
+	}, nil
+}
+
+// NATOn enables forwarding and NAT for VPN clients and applies the egress
+// firewall policy.
+func (o *OpenVPN) NATOn() error {
+	conf, err := o.natConfig()
+	if err != nil {
+		return err
+	}
+	return nat.On(conf)
+}
+
+// NATOff disables NAT for VPN clients and restores forwarding state.
+func (o *OpenVPN) NATOff() error {
+	conf, err := o.natConfig()
+	if err != nil {
+		return err
+	}
+	return nat.Off(conf)
+}
+
+// NATStatus returns forwarding state and NAT rules for VPN clients.
+func (o *OpenVPN) NATStatus() (*nat.Status, error) {
+	conf, err := o.natConfig()
+	if err != nil {
+		return nil, err
+	}
+	return nat.GetStatus(conf)
+}
@@ -1,8 +1,10 @@
 package openvpn
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -14,28 +16,43 @@ import (
 
 	"github.com/takama/daemon"
 
+	"github.com/privatix/dapp-openvpn/inst/nat"
 	"github.com/privatix/dapp-openvpn/inst/openvpn/path"
+	"github.com/privatix/dapp-openvpn/inst/pipeline"
 	"github.com/privatix/dapp-openvpn/statik"
 )
 
 // OpenVPN has a openvpn configuration.
 type OpenVPN struct {
-	Path            string
-	Role            string
-	Tap             *tapInterface
-	Proto           string
-	Host            *host
-	Managment       *host
-	Server          *host
-	Service         string
-	Adapter         *DappVPN
-	Validity        *validity
-	IsWindows       bool
-	User            string
-	Group           string
-	Import          bool
-	Install         bool
-	ForwardingState string
+	Path                string
+	Role                string
+	Tap                 *tapInterface
+	Proto               string
+	Host                *host
+	Managment           *host
+	Server              *host
+	Subnet              string
+	TLSMode             string
+	KeyAlgorithm        string
+	DataCiphers         []string
+	DataCiphersFallback string
+	Compression         string
+	Version             string
+	Service             string
+	Adapter             *DappVPN
+	Validity            *validity
+	IsWindows           bool
+	User                string
+	Group               string
+	Import              bool
+	Install             bool
+	ForwardingState     string
+	Firewall            *nat.Policy
+	Hooks               *Hooks
+
+	journal  *pipeline.Journal
+	plan     *pipeline.Plan
+	snapshot string
 }
 
 type validity struct {
@@ -65,18 +82,42 @@ func NewOpenVPN() *OpenVPN {
 			IP:   "127.0.0.1",
 			Port: 7505,
 		},
-		Server: &host{
-			IP:   "10.217.3.0",
-			Mask: "255.255.255.0",
-		},
+		Server:       &host{},
+		TLSMode:      tlsCrypt,
+		KeyAlgorithm: ecdsaP256,
+		DataCiphers: []string{
+			"AES-256-GCM", "AES-128-GCM", "CHACHA20-POLY1305"},
+		DataCiphersFallback: "AES-256-CBC",
+		Compression:         "no",
 		Validity: &validity{
 			Year: 10,
 		},
 		IsWindows: strings.EqualFold(runtime.GOOS, "windows"),
 		Adapter:   NewDappVPN(),
+		Firewall:  nat.DefaultPolicy(),
 	}
 }
 
+// Journal returns the journal of the running flow.
+func (o *OpenVPN) Journal() *pipeline.Journal {
+	return o.journal
+}
+
+// SetJournal sets the journal of the running flow.
+func (o *OpenVPN) SetJournal(j *pipeline.Journal) {
+	o.journal = j
+}
+
+// Plan returns the plan of the running flow, if it is planned.
+func (o *OpenVPN) Plan() *pipeline.Plan {
+	return o.plan
+}
+
+// SetPlan makes the running flow to be planned instead of executed.
+func (o *OpenVPN) SetPlan(p *pipeline.Plan) {
+	o.plan = p
+}
+
 // InstallTap installs a new tap interface.
 func (o *OpenVPN) InstallTap() (err error) {
 	if !o.IsWindows {
@@ -123,28 +164,46 @@ func (o *OpenVPN) Configurate() error {
 			0777)
 	}
 
+	if err := o.configureSubnet(); err != nil {
+		return err
+	}
+
+	if err := o.writeFirewallPolicy(); err != nil {
+		return err
+	}
+
 	if err := o.createCertificate(); err != nil {
 		return err
 	}
 
+	if err := o.createTLSKey(); err != nil {
+		return err
+	}
+
 	return o.createConfig()
 }
 
 func (o *OpenVPN) createConfig() error {
-	file, err := os.Create(filepath.Join(o.Path, path.RoleConfig(o.Role)))
+	data, err := o.renderConfig()
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
+	return ioutil.WriteFile(
+		filepath.Join(o.Path, path.RoleConfig(o.Role)), data, 0644)
+}
+
+// renderConfig sets dynamic parameters and returns the server
+// configuration built from the template.
+func (o *OpenVPN) renderConfig() ([]byte, error) {
 	data, err := statik.ReadFile(path.Config.ServerConfigTemplate)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	templ, err := template.New("ovpnTemplate").Parse(string(data))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Set dynamic port.
@@ -158,11 +217,19 @@ func (o *OpenVPN) createConfig() error {
 	if !o.IsWindows {
 		o.User, o.Group, err = getUserGroup()
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return templ.Execute(file, &o)
+	if err := o.configureCiphers(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := templ.Execute(&buf, &o); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
 // RemoveConfig removes openvpn configuration.
@@ -176,6 +243,8 @@ func (o *OpenVPN) RemoveConfig() error {
 		path.Config.DHParam,
 		path.Config.CACertificate,
 		path.Config.CAKey,
+		path.Config.TLSKey,
+		path.Config.FirewallConfig,
 		path.RoleCertificate(o.Role),
 		path.RoleKey(o.Role),
 		path.RoleConfig(o.Role),
@@ -185,6 +254,10 @@ func (o *OpenVPN) RemoveConfig() error {
 		os.RemoveAll(filepath.Join(o.Path, path))
 	}
 
+	if err := removeNatRules(o.Path); err != nil {
+		return err
+	}
+
 	if runtime.GOOS != "darwin" {
 		return nil
 	}
@@ -205,28 +278,34 @@ func (o *OpenVPN) RemoveConfig() error {
 }
 
 func (o *OpenVPN) createCertificate() error {
+	if !validKeyAlgorithm(o.KeyAlgorithm) {
+		return fmt.Errorf("unknown key algorithm: %s", o.KeyAlgorithm)
+	}
+	o.KeyAlgorithm = strings.ToLower(o.KeyAlgorithm)
+
 	p := filepath.Join(o.Path, "config")
 	t := time.Now().AddDate(o.Validity.Year,
 		o.Validity.Month, o.Validity.Day)
-	if err := buildServerCertificate(p, t); err != nil {
-		return err
-	}
+	return buildServerCertificate(p, o.KeyAlgorithm, t)
+}
 
-	// Generate Diffie Hellman param.
-	ossl := filepath.Join(o.Path, path.Config.OpenSSL)
-	dh := filepath.Join(p, "dh2048.pem")
+// ECDHCurve returns a curve for ECDH key exchange, Diffie Hellman
+// parameters are not used.
+func (o *OpenVPN) ECDHCurve() string {
+	return ecdhCurve(o.KeyAlgorithm)
+}
 
-	// temporary, it will be removed after testing
-	if _, err := os.Stat(dh); err == nil {
-		return nil
+func (o *OpenVPN) createTLSKey() error {
+	if !validTLSMode(o.TLSMode) {
+		return fmt.Errorf("unknown tls key mode: %s", o.TLSMode)
 	}
 
-	err := exec.Command(ossl, "dhparam", "-out", dh, "2048").Run()
-	if err != nil {
-		cmd := exec.Command("openssl", "dhparam", "-out", dh, "2048")
-		return cmd.Run()
+	o.TLSMode = strings.ToLower(o.TLSMode)
+	if len(o.TLSMode) == 0 {
+		return nil
 	}
-	return nil
+
+	return buildTLSKey(filepath.Join(o.Path, path.Config.TLSKey), o.TLSMode)
 }
 
 func (o *OpenVPN) isClient() bool {
@@ -240,11 +319,10 @@ func (o *OpenVPN) InstallService() (string, error) {
 	}
 
 	var dependencies []string
-	o.Service = serviceName(path.Config.OVPN, o.Path)
+	o.Service = o.serviceName()
 	descr := fmt.Sprintf("Privatix %s OpenVPN %s", o.Role, hash(o.Path))
 
 	if o.IsWindows {
-		o.Service = fmt.Sprintf("Privatix OpenVPN %s", hash(o.Path))
 		dependencies = []string{"tap0901", "dhcp"}
 	}
 
@@ -275,6 +353,13 @@ func (o *OpenVPN) InstallService() (string, error) {
 	return "", runPowerShellCommand(args...)
 }
 
+func (o *OpenVPN) serviceName() string {
+	if o.IsWindows {
+		return fmt.Sprintf("Privatix OpenVPN %s", hash(o.Path))
+	}
+	return serviceName(path.Config.OVPN, o.Path)
+}
+
 // StartService starts openvpn service.
 func (o *OpenVPN) StartService() (string, error) {
 	if o.isClient() {
@@ -397,19 +482,36 @@ func (o *OpenVPN) RemoveService() (string, error) {
 
 // CreateForwardingDaemon creates daemon on unix-system.
 func (o *OpenVPN) CreateForwardingDaemon() error {
-	return createNatRules(o.Path, o.Server.IP, o.Host.Port)
+	return createNatRules(o)
 }
 
 // Update updates the product.
 func (o *OpenVPN) Update() error {
+	configDir := filepath.Join(o.Path, "config")
+	dataDir := filepath.Join(o.Path, "data")
+
+	newPath := o.updatePath()
+	newConfigDir := filepath.Join(newPath, "config")
+	newDataDir := filepath.Join(newPath, "data")
+
+	if err := copyDir(newConfigDir, configDir); err != nil {
+		return err
+	}
+
+	if err := copyDir(newDataDir, dataDir); err != nil {
+		return err
+	}
+
+	return merge(newConfigDir, configDir)
+}
+
+// updatePath returns a location of the new product version.
+func (o *OpenVPN) updatePath() string {
 	role := "agent"
 	if o.isClient() {
 		role = "client"
 	}
 
-	configDir := filepath.Join(o.Path, "config")
-	dataDir := filepath.Join(o.Path, "data")
-
 	newPath := strings.Replace(o.Path, role+"_new", role, 1)
 
 	productTempPath := os.Getenv("PRIVATIX_TEMP_PRODUCT")
@@ -430,18 +532,5 @@ func (o *OpenVPN) Update() error {
 	if len(productTempPath) > 0 {
 		filepath.Walk(productTempPath, findProduct)
 	}
-
-	newConfigDir := filepath.Join(newPath, "config")
-	newDataDir := filepath.Join(newPath, "data")
-
-	if err := copyDir(newConfigDir, configDir); err != nil {
-		return err
-	}
-
-	if err := copyDir(newDataDir, dataDir); err != nil {
-		return err
-	}
-
-	// TODO: looks like useless step, newConfigDir has everything from configDir coppied.
-	return merge(newConfigDir, configDir)
+	return newPath
 }
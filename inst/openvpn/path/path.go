@@ -40,6 +40,8 @@ type config struct {
 	CACertificate string
 	// CAKey file location
 	CAKey string
+	// TLSKey control channel protection key location
+	TLSKey string
 	// ServerConfigTemplate file location
 	ServerConfigTemplate string
 	// Adapter file location
@@ -60,10 +62,18 @@ type config struct {
 	PowerShellReEnableNat string
 	// OpenVPN nat script location
 	NatScript string
+	// NatState forwarding state to restore location
+	NatState string
+	// FirewallConfig egress firewall policy location
+	FirewallConfig string
 	// OpenVPN up script location
 	UpScript string
 	// OpenVPN down script location
 	DownScript string
+	// BackupDir product snapshots made on update location
+	BackupDir string
+	// PendingUpdate snapshot of an update to check on start location
+	PendingUpdate string
 }
 
 // newConfig creates a default path configuration.
@@ -78,6 +88,7 @@ func newConfig() *config {
 		DHParam:                "config/dh2048.pem",
 		CACertificate:          "config/ca.crt",
 		CAKey:                  "config/ca.key",
+		TLSKey:                 "config/ta.key",
 		ServerConfigTemplate:   "/ovpn/templates/server-config.tpl",
 		Adapter:                "bin/dappvpn",
 		AdapterConfig:          "config/adapter.config.json",
@@ -88,8 +99,12 @@ func newConfig() *config {
 		PowerShellScheduleTask: "bin/new-startuptask.ps1",
 		PowerShellReEnableNat:  "bin/reenable-nat.ps1",
 		NatScript:              "bin/nat-pf.sh",
+		NatState:               "config/nat.state",
+		FirewallConfig:         "config/firewall.config.json",
 		UpScript:               "bin/client-up.sh",
 		DownScript:             "bin/client-down.sh",
+		BackupDir:              "backup",
+		PendingUpdate:          "backup/pending",
 	}
 }
 
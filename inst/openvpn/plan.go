@@ -0,0 +1,371 @@
+package openvpn
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/privatix/dapp-openvpn/inst/nat"
+	"github.com/privatix/dapp-openvpn/inst/openvpn/path"
+	"github.com/privatix/dapp-openvpn/inst/pipeline"
+)
+
+// generatedChange describes writing a key, a certificate or a daemon
+// definition to the file. The content is generated on execution and
+// is not shown.
+func generatedChange(file string) pipeline.Change {
+	c := pipeline.Change{Kind: pipeline.KindFile, Target: file,
+		Action: "create"}
+	if _, err := os.Stat(file); err == nil {
+		c.Action = "replace"
+	}
+	return c
+}
+
+// removeChanges describes removing of the existing files.
+func removeChanges(files ...string) []pipeline.Change {
+	var changes []pipeline.Change
+	for _, file := range files {
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		changes = append(changes, pipeline.Change{
+			Kind:   pipeline.KindFile,
+			Target: file,
+			Action: "remove",
+		})
+	}
+	return changes
+}
+
+func powerShellChange(args ...string) pipeline.Change {
+	return pipeline.CommandChange("powershell", args...)
+}
+
+// PlanInstallTap describes the changes of InstallTap.
+func (o *OpenVPN) PlanInstallTap() []pipeline.Change {
+	if !o.IsWindows {
+		return nil
+	}
+
+	changes := []pipeline.Change{{
+		Kind:   pipeline.KindDevice,
+		Target: "tap0901",
+		Action: "install",
+	}}
+	if o.isClient() {
+		return changes
+	}
+
+	script := filepath.Join(o.Path, path.Config.PowerShellVpnNat)
+	return append(changes, powerShellChange(buildPowerShellArgs(script,
+		"-TAPdeviceAddress", "<device>", "-Enabled", "-Force")...))
+}
+
+// PlanRemoveTap describes the changes of RemoveTap.
+func (o *OpenVPN) PlanRemoveTap() []pipeline.Change {
+	if !o.IsWindows {
+		return nil
+	}
+
+	var changes []pipeline.Change
+	if !o.isClient() {
+		script := filepath.Join(o.Path, path.Config.PowerShellVpnNat)
+		changes = append(changes, powerShellChange(buildPowerShellArgs(
+			script, "-TAPdeviceAddress", o.Tap.DeviceID)...))
+	}
+
+	return append(changes, pipeline.Change{
+		Kind:   pipeline.KindDevice,
+		Target: o.Tap.DeviceID,
+		Action: "remove",
+	})
+}
+
+// PlanConfigurate describes the changes of Configurate.
+func (o *OpenVPN) PlanConfigurate() ([]pipeline.Change, error) {
+	if o.isClient() {
+		o.Managment.Port = nextFreePort(*o.Managment, "tcp")
+		if runtime.GOOS != "darwin" {
+			return nil, nil
+		}
+
+		return []pipeline.Change{
+			pipeline.CommandChange("chmod", "0777",
+				filepath.Join(o.Path, path.Config.UpScript)),
+			pipeline.CommandChange("chmod", "0777",
+				filepath.Join(o.Path, path.Config.DownScript)),
+		}, nil
+	}
+
+	if err := o.configureSubnet(); err != nil {
+		return nil, err
+	}
+
+	var changes []pipeline.Change
+
+	if o.Firewall == nil {
+		o.Firewall = nat.DefaultPolicy()
+	}
+	if err := o.Firewall.Validate(); err != nil {
+		return nil, err
+	}
+	if runtime.GOOS == "linux" {
+		data, err := nat.EncodePolicy(o.Firewall)
+		if err != nil {
+			return nil, err
+		}
+		file := filepath.Join(o.Path, path.Config.FirewallConfig)
+		changes = append(changes, pipeline.FileChange(file, data))
+	}
+
+	if !validKeyAlgorithm(o.KeyAlgorithm) {
+		return nil, fmt.Errorf("unknown key algorithm: %s",
+			o.KeyAlgorithm)
+	}
+	o.KeyAlgorithm = strings.ToLower(o.KeyAlgorithm)
+	for _, v := range []string{
+		path.Config.CACertificate,
+		path.Config.CAKey,
+		path.RoleCertificate(o.Role),
+		path.RoleKey(o.Role),
+	} {
+		changes = append(changes,
+			generatedChange(filepath.Join(o.Path, v)))
+	}
+
+	if !validTLSMode(o.TLSMode) {
+		return nil, fmt.Errorf("unknown tls key mode: %s", o.TLSMode)
+	}
+	o.TLSMode = strings.ToLower(o.TLSMode)
+	if len(o.TLSMode) != 0 {
+		file := filepath.Join(o.Path, path.Config.TLSKey)
+		changes = append(changes, generatedChange(file))
+	}
+
+	data, err := o.renderConfig()
+	if err != nil {
+		return nil, err
+	}
+	return append(changes, pipeline.FileChange(
+		filepath.Join(o.Path, path.RoleConfig(o.Role)), data)), nil
+}
+
+// PlanRemoveConfig describes the changes of RemoveConfig.
+func (o *OpenVPN) PlanRemoveConfig() []pipeline.Change {
+	if o.isClient() {
+		return removeChanges(filepath.Join(o.Path, path.Config.DataDir))
+	}
+
+	var files []string
+	for _, v := range []string{
+		path.Config.DHParam,
+		path.Config.CACertificate,
+		path.Config.CAKey,
+		path.Config.TLSKey,
+		path.Config.FirewallConfig,
+		path.RoleCertificate(o.Role),
+		path.RoleKey(o.Role),
+		path.RoleConfig(o.Role),
+		path.Config.DataDir,
+	} {
+		files = append(files, filepath.Join(o.Path, v))
+	}
+	changes := removeChanges(files...)
+
+	name := serviceName("nat", o.Path)
+	daemon := daemonPath(name)
+	switch runtime.GOOS {
+	case "linux":
+		if _, err := os.Stat(daemon); err == nil {
+			changes = append(changes,
+				pipeline.ServiceChange("stop", name),
+				pipeline.ServiceChange("disable", name))
+			changes = append(changes, removeChanges(daemon)...)
+		}
+	case "darwin":
+		natScript := filepath.Join(o.Path, path.Config.NatScript)
+		changes = append(changes,
+			pipeline.CommandChange("/bin/sh", natScript, "off",
+				o.ForwardingState),
+			pipeline.CommandChange("launchctl", "unload", daemon))
+		changes = append(changes, removeChanges(daemon)...)
+	}
+	return changes
+}
+
+// PlanInstallService describes the changes of InstallService.
+func (o *OpenVPN) PlanInstallService() []pipeline.Change {
+	if o.isClient() {
+		return nil
+	}
+
+	o.Service = o.serviceName()
+	changes := []pipeline.Change{
+		pipeline.ServiceChange("create", o.Service)}
+	if !o.IsWindows {
+		return changes
+	}
+
+	script := filepath.Join(o.Path, path.Config.PowerShellScheduleTask)
+	reEnable := filepath.Join(o.Path, path.Config.PowerShellReEnableNat)
+	changes = append(changes, powerShellChange("-ExecutionPolicy",
+		"Bypass", "-NoProfile", "-File", script,
+		"-scriptPath", reEnable, "-TAPdeviceAddress", o.Tap.DeviceID))
+
+	script = filepath.Join(o.Path, path.Config.PowerShellVpnFirewall)
+	ovpn := filepath.Join(o.Path, path.Config.OpenVPN+".exe")
+	return append(changes, powerShellChange(buildPowerShellArgs(script,
+		"-Create", "-ServiceName",
+		strings.Join(strings.Fields(o.Service), "_"),
+		"-ProgramPath", ovpn, "-Port", fmt.Sprint(o.Host.Port),
+		"-Protocol", o.Proto[:3])...))
+}
+
+// PlanServiceAction describes an action on the openvpn service.
+func (o *OpenVPN) PlanServiceAction(action string) []pipeline.Change {
+	if o.isClient() {
+		return nil
+	}
+	return []pipeline.Change{pipeline.ServiceChange(action, o.Service)}
+}
+
+// PlanRemoveService describes the changes of RemoveService.
+func (o *OpenVPN) PlanRemoveService() []pipeline.Change {
+	if o.isClient() {
+		return nil
+	}
+
+	var changes []pipeline.Change
+	if o.IsWindows {
+		script := filepath.Join(o.Path,
+			path.Config.PowerShellVpnFirewall)
+		name := strings.Join(strings.Fields(o.Service), "_")
+		changes = append(changes,
+			powerShellChange(buildPowerShellArgs(script, "-Remove",
+				"-ServiceName", name)...),
+			powerShellChange("Unregister-ScheduledTask",
+				"-TaskName", "'Privatix re-enable ICS'"))
+	}
+	return append(changes, pipeline.ServiceChange("remove", o.Service))
+}
+
+// PlanForwardingDaemon describes the changes of CreateForwardingDaemon.
+func (o *OpenVPN) PlanForwardingDaemon() []pipeline.Change {
+	name := serviceName("nat", o.Path)
+	file := daemonPath(name)
+
+	switch runtime.GOOS {
+	case "linux":
+		return []pipeline.Change{
+			generatedChange(file),
+			pipeline.CommandChange("systemctl", "enable", file),
+			pipeline.ServiceChange("start", name),
+		}
+	case "darwin":
+		return []pipeline.Change{
+			generatedChange(file),
+			pipeline.CommandChange("launchctl", "load", file),
+		}
+	}
+	return nil
+}
+
+// PlanUpdate describes the changes of Update.
+func (o *OpenVPN) PlanUpdate() ([]pipeline.Change, error) {
+	newPath := o.updatePath()
+	newConfigDir := filepath.Join(newPath, "config")
+
+	var changes []pipeline.Change
+	for _, dir := range []string{"config", "data"} {
+		c, err := planCopyDir(filepath.Join(newPath, dir),
+			filepath.Join(o.Path, dir))
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, c...)
+	}
+
+	fds, err := ioutil.ReadDir(newConfigDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, fd := range fds {
+		if !strings.EqualFold(filepath.Ext(fd.Name()), ".json") {
+			continue
+		}
+
+		newFile := filepath.Join(newConfigDir, fd.Name())
+		file := filepath.Join(o.Path, "config", fd.Name())
+		if _, err := os.Stat(file); err != nil {
+			// The file is copied from the new version.
+			continue
+		}
+
+		data, err := mergedJSONFile(newFile, file)
+		if err != nil {
+			return nil, err
+		}
+		if c := pipeline.FileChange(file, data); c.Action != "keep" {
+			changes = append(changes, c)
+		}
+	}
+	return changes, nil
+}
+
+// planCopyDir describes the changes of copyDir.
+func planCopyDir(src, dst string) ([]pipeline.Change, error) {
+	fds, err := ioutil.ReadDir(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []pipeline.Change
+	for _, fd := range fds {
+		srcfp := filepath.Join(src, fd.Name())
+		dstfp := filepath.Join(dst, fd.Name())
+		if fd.IsDir() {
+			c, err := planCopyDir(srcfp, dstfp)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, c...)
+			continue
+		}
+
+		// Existing files are not overwritten.
+		if _, err := os.Stat(dstfp); err == nil {
+			continue
+		}
+		changes = append(changes, pipeline.Change{
+			Kind:   pipeline.KindFile,
+			Target: dstfp,
+			Action: "copy from " + srcfp,
+		})
+	}
+	return changes, nil
+}
+
+// PlanConfigurate describes the changes of Configurate.
+func (d *DappVPN) PlanConfigurate(o *OpenVPN) ([]pipeline.Change, error) {
+	data, err := d.config(o)
+	if err != nil {
+		return nil, err
+	}
+	return []pipeline.Change{pipeline.FileChange(
+		filepath.Join(o.Path, path.Config.AdapterConfig), data)}, nil
+}
+
+// PlanInstallService describes the changes of InstallService.
+func (d *DappVPN) PlanInstallService(dir string) []pipeline.Change {
+	d.Service = adapterServiceName(dir)
+	return []pipeline.Change{pipeline.ServiceChange("create", d.Service)}
+}
+
+// PlanServiceAction describes an action on the dappvpn service.
+func (d *DappVPN) PlanServiceAction(action string) []pipeline.Change {
+	return []pipeline.Change{pipeline.ServiceChange(action, d.Service)}
+}
@@ -0,0 +1,203 @@
+package openvpn
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/takama/daemon"
+
+	adapter "github.com/privatix/dapp-openvpn/adapter/config"
+	"github.com/privatix/dapp-openvpn/inst/nat"
+	"github.com/privatix/dapp-openvpn/inst/openvpn/path"
+)
+
+const dialTimeout = 3 * time.Second
+
+// Status has a state of the installation.
+type Status struct {
+	Services     []ServiceStatus
+	Ports        []PortStatus
+	Certificates []Certificate
+	// CertificatesError is set, if the certificates can not be read.
+	CertificatesError string
+	NAT               *nat.Status
+	// NATError is set, if the NAT status can not be read.
+	NATError string
+	// AdapterConfigError is set, if the adapter config is invalid.
+	AdapterConfigError string
+}
+
+// ServiceStatus is a state of a service.
+type ServiceStatus struct {
+	Name   string
+	Status string
+}
+
+// PortStatus is a state of a port.
+type PortStatus struct {
+	Name      string
+	Proto     string
+	Addr      string
+	Listening bool
+}
+
+// Status returns the state of the installation.
+func (o *OpenVPN) Status() *Status {
+	s := &Status{}
+
+	var services []string
+	if !o.isClient() {
+		services = append(services, o.Service)
+	}
+	for _, name := range append(services, o.Adapter.Service) {
+		s.Services = append(s.Services,
+			ServiceStatus{Name: name, Status: serviceStatus(name)})
+	}
+
+	s.Ports = o.ports()
+
+	if !o.isClient() {
+		certs, err := o.Certificates()
+		if err != nil {
+			s.CertificatesError = err.Error()
+		}
+		s.Certificates = certs
+
+		status, err := o.NATStatus()
+		if err != nil {
+			s.NATError = err.Error()
+		}
+		s.NAT = status
+	}
+
+	if err := o.checkAdapterConfig(); err != nil {
+		s.AdapterConfigError = err.Error()
+	}
+	return s
+}
+
+func serviceStatus(name string) string {
+	if len(name) == 0 {
+		return "not installed"
+	}
+
+	service, err := daemon.New(name, "")
+	if err != nil {
+		return err.Error()
+	}
+
+	status, err := service.Status()
+	if err != nil {
+		return err.Error()
+	}
+	return strings.TrimSpace(status)
+}
+
+// managementPort is a name of the management port. OpenVPN accepts a single
+// management client and stops listening while the adapter is attached.
+const managementPort = "management"
+
+// ports returns the VPN and the management ports of the server
+// configuration.
+func (o *OpenVPN) ports() []PortStatus {
+	if o.isClient() {
+		return nil
+	}
+
+	config := filepath.Join(o.Path, path.RoleConfig(o.Role))
+
+	var ports []PortStatus
+	if addr, err := configManagementAddr(config); err == nil {
+		ports = append(ports, PortStatus{
+			Name:      managementPort,
+			Proto:     "tcp",
+			Addr:      addr,
+			Listening: listening("tcp", addr),
+		})
+	}
+
+	port, err := configOption(config, "port")
+	if err != nil || len(port) == 0 {
+		return ports
+	}
+
+	proto := "udp"
+	if args, err := configOption(config, "proto"); err == nil &&
+		len(args) != 0 && strings.HasPrefix(args[0], "tcp") {
+		proto = "tcp"
+	}
+
+	host := "0.0.0.0"
+	if args, err := configOption(config, "local"); err == nil &&
+		len(args) != 0 {
+		host = args[0]
+	}
+
+	addr := net.JoinHostPort(host, port[0])
+	return append(ports, PortStatus{
+		Name:      "vpn",
+		Proto:     proto,
+		Addr:      addr,
+		Listening: listening(proto, addr),
+	})
+}
+
+// listening checks that the port is in use. TCP port is connected to,
+// UDP port is tried to bind.
+func listening(proto, addr string) bool {
+	if proto == "udp" {
+		conn, err := net.ListenPacket(proto, addr)
+		if err != nil {
+			return true
+		}
+		conn.Close()
+		return false
+	}
+
+	conn, err := net.DialTimeout(proto, localAddr(addr), dialTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// localAddr replaces an unspecified host with the loopback address.
+func localAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// checkAdapterConfig checks that the adapter config is valid and refers
+// to existing files.
+func (o *OpenVPN) checkAdapterConfig() error {
+	file := filepath.Join(o.Path, path.Config.AdapterConfig)
+	conf, err := adapter.Read(file)
+	if err != nil {
+		return err
+	}
+
+	if err := conf.ResolveSecrets(filepath.Dir(file)); err != nil {
+		return fmt.Errorf("failed to resolve secrets: %v", err)
+	}
+
+	if _, err := os.Stat(conf.OpenVPN.Name); err != nil {
+		return fmt.Errorf("openvpn binary is not found: %v", err)
+	}
+
+	if _, err := os.Stat(conf.OpenVPN.ConfigRoot); err != nil {
+		return fmt.Errorf("openvpn config root is not found: %v", err)
+	}
+	return nil
+}
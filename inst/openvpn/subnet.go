@@ -0,0 +1,196 @@
+package openvpn
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// preferredSubnet is picked when it's free, it's the subnet used before
+// the subnet became configurable.
+const preferredSubnet = "10.217.3.0/24"
+
+// subnetRanges are RFC1918 ranges to pick a free /24 subnet from.
+var subnetRanges = []string{"10.217.0.0/16", "172.16.0.0/12", "192.168.0.0/16"}
+
+// parseSubnet parses an IPv4 subnet in CIDR notation. Only /8, /16 and
+// /24 subnets are supported, client route policies and NAT scripts match
+// the subnet by whole octets.
+func parseSubnet(cidr string) (*net.IPNet, error) {
+	ip, subnet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+	if err != nil || ip.To4() == nil {
+		return nil, fmt.Errorf("invalid subnet: %s", cidr)
+	}
+
+	ones, _ := subnet.Mask.Size()
+	if ones == 0 || ones > 24 || ones%8 != 0 {
+		return nil, fmt.Errorf("subnet size is not supported: %s", cidr)
+	}
+
+	subnet.IP = subnet.IP.To4()
+	return subnet, nil
+}
+
+func overlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// conflict finds a local network which overlaps with a given subnet.
+func conflict(subnet *net.IPNet, networks []*net.IPNet) *net.IPNet {
+	for _, v := range networks {
+		if overlap(subnet, v) {
+			return v
+		}
+	}
+	return nil
+}
+
+// interfaceNetworks returns networks of local network interfaces.
+func interfaceNetworks() ([]*net.IPNet, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+
+	var networks []*net.IPNet
+	for _, v := range addrs {
+		if ipnet, ok := v.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+			networks = append(networks, &net.IPNet{
+				IP:   ipnet.IP.Mask(ipnet.Mask),
+				Mask: ipnet.Mask,
+			})
+		}
+	}
+	return networks, nil
+}
+
+// dockerNetworks returns subnets of docker networks, including networks
+// without running containers. Docker is optional.
+func dockerNetworks() []*net.IPNet {
+	docker, err := exec.LookPath("docker")
+	if err != nil {
+		return nil
+	}
+
+	ids, err := exec.Command(docker, "network", "ls", "-q").Output()
+	if err != nil || len(strings.TrimSpace(string(ids))) == 0 {
+		return nil
+	}
+
+	args := append([]string{"network", "inspect", "--format",
+		"{{range .IPAM.Config}}{{.Subnet}} {{end}}"},
+		strings.Fields(string(ids))...)
+	out, err := exec.Command(docker, args...).Output()
+	if err != nil {
+		return nil
+	}
+
+	var networks []*net.IPNet
+	for _, v := range strings.Fields(string(out)) {
+		if _, subnet, err := net.ParseCIDR(v); err == nil &&
+			subnet.IP.To4() != nil {
+			networks = append(networks, subnet)
+		}
+	}
+	return networks
+}
+
+// localNetworks returns networks which are in use on the host. Default
+// routes are skipped, since they overlap with any subnet.
+func localNetworks() ([]*net.IPNet, error) {
+	networks, err := interfaceNetworks()
+	if err != nil {
+		return nil, err
+	}
+
+	routes, err := localRoutes()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*net.IPNet
+	for _, v := range append(append(networks, routes...),
+		dockerNetworks()...) {
+		if ones, _ := v.Mask.Size(); ones != 0 && !v.IP.IsLoopback() {
+			result = append(result, v)
+		}
+	}
+	return result, nil
+}
+
+// freeSubnet picks a /24 subnet which does not overlap with given networks.
+func freeSubnet(networks []*net.IPNet) (*net.IPNet, error) {
+	preferred, _ := parseSubnet(preferredSubnet)
+	if conflict(preferred, networks) == nil {
+		return preferred, nil
+	}
+
+	mask := net.CIDRMask(24, 32)
+	for _, v := range subnetRanges {
+		_, r, _ := net.ParseCIDR(v)
+		ones, _ := r.Mask.Size()
+		start := binary.BigEndian.Uint32(r.IP.To4())
+
+		for i := uint32(0); i < 1<<uint(24-ones); i++ {
+			ip := make(net.IP, net.IPv4len)
+			binary.BigEndian.PutUint32(ip, start+i<<8)
+
+			subnet := &net.IPNet{IP: ip, Mask: mask}
+			if conflict(subnet, networks) == nil {
+				return subnet, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no free subnet found")
+}
+
+// configureSubnet picks a free tunnel subnet or validates a configured one
+// against local networks.
+func (o *OpenVPN) configureSubnet() error {
+	networks, err := localNetworks()
+	if err != nil {
+		return err
+	}
+
+	// Subnet given as a server address and mask.
+	if len(o.Subnet) == 0 && len(o.Server.IP) != 0 {
+		ones, _ := net.IPMask(net.ParseIP(o.Server.Mask).To4()).Size()
+		o.Subnet = fmt.Sprintf("%s/%d", o.Server.IP, ones)
+	}
+
+	var subnet *net.IPNet
+	if len(o.Subnet) == 0 {
+		if subnet, err = freeSubnet(networks); err != nil {
+			return err
+		}
+	} else {
+		if subnet, err = parseSubnet(o.Subnet); err != nil {
+			return err
+		}
+
+		if v := conflict(subnet, networks); v != nil {
+			return fmt.Errorf("subnet %s conflicts with local network %s",
+				subnet, v)
+		}
+	}
+
+	o.Subnet = subnet.String()
+	o.Server.IP = subnet.IP.String()
+	o.Server.Mask = net.IP(subnet.Mask).String()
+	return nil
+}
+
+// ServerIP returns an address of the server in the tunnel subnet, OpenVPN
+// takes the first address of the subnet.
+func (o *OpenVPN) ServerIP() string {
+	ip := net.ParseIP(o.Server.IP).To4()
+	if ip == nil {
+		return ""
+	}
+
+	gw := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(gw, binary.BigEndian.Uint32(ip)+1)
+	return gw.String()
+}
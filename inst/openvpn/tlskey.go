@@ -0,0 +1,61 @@
+package openvpn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Control channel protection modes.
+const (
+	tlsAuth      = "tls-auth"
+	tlsCrypt     = "tls-crypt"
+	staticKeyLen = 256 // 2048 bit OpenVPN static key.
+)
+
+func validTLSMode(mode string) bool {
+	switch strings.ToLower(mode) {
+	case "", tlsAuth, tlsCrypt:
+		return true
+	}
+	return false
+}
+
+// buildTLSKey generates a key to protect the control channel. It is
+// an OpenVPN static key shared by the server and all clients.
+func buildTLSKey(file, mode string) error {
+	var data []byte
+	var err error
+
+	switch strings.ToLower(mode) {
+	case tlsAuth, tlsCrypt:
+		data, err = staticKey()
+	default:
+		return fmt.Errorf("unknown tls key mode: %s", mode)
+	}
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, data, 0600)
+}
+
+func staticKey() ([]byte, error) {
+	key := make([]byte, staticKeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("#\n# 2048 bit OpenVPN static key\n#\n")
+	buf.WriteString("-----BEGIN OpenVPN Static key V1-----\n")
+	for i := 0; i < len(key); i += 16 {
+		buf.WriteString(hex.EncodeToString(key[i:i+16]) + "\n")
+	}
+	buf.WriteString("-----END OpenVPN Static key V1-----\n")
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,173 @@
+package openvpn
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/privatix/dapp-openvpn/inst/openvpn/path"
+)
+
+// updateDirs are product directories changed on update.
+var updateDirs = []string{"config", "data"}
+
+// Snapshot copies the product directories changed on update to a backup
+// directory. Older snapshots are removed.
+func (o *OpenVPN) Snapshot() error {
+	backup := filepath.Join(o.Path, path.Config.BackupDir)
+	dir := filepath.Join(backup, time.Now().Format("20060102150405"))
+
+	for _, v := range updateDirs {
+		src := filepath.Join(o.Path, v)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+
+		if err := copyDir(src, filepath.Join(dir, v)); err != nil {
+			os.RemoveAll(dir)
+			return err
+		}
+	}
+
+	fds, err := ioutil.ReadDir(backup)
+	if err != nil {
+		return err
+	}
+	for _, fd := range fds {
+		if old := filepath.Join(backup, fd.Name()); old != dir {
+			os.RemoveAll(old)
+		}
+	}
+
+	o.snapshot = dir
+	return nil
+}
+
+// RestoreSnapshot replaces the product directories with their copies
+// made by Snapshot.
+func (o *OpenVPN) RestoreSnapshot() error {
+	if len(o.snapshot) == 0 {
+		return nil
+	}
+
+	for _, v := range updateDirs {
+		src := filepath.Join(o.snapshot, v)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+
+		dst := filepath.Join(o.Path, v)
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+
+		if err := copyDir(src, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarkPending records the snapshot of an update, which services are started
+// after the installer exits. The update is checked by the next start.
+func (o *OpenVPN) MarkPending() error {
+	file := filepath.Join(o.Path, path.Config.PendingUpdate)
+	return ioutil.WriteFile(file, []byte(o.snapshot), 0644)
+}
+
+// PendingUpdate loads the snapshot of an update, which is not checked yet.
+// It returns false, if there is no such update.
+func (o *OpenVPN) PendingUpdate() (bool, error) {
+	file := filepath.Join(o.Path, path.Config.PendingUpdate)
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	o.snapshot = strings.TrimSpace(string(data))
+	return true, nil
+}
+
+// ClearPending removes the record of a checked update.
+func (o *OpenVPN) ClearPending() error {
+	err := os.Remove(filepath.Join(o.Path, path.Config.PendingUpdate))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// ValidateConfig checks that the product json configs are valid after
+// update.
+func (o *OpenVPN) ValidateConfig() error {
+	configDir := filepath.Join(o.Path, "config")
+	fds, err := ioutil.ReadDir(configDir)
+	if err != nil {
+		return err
+	}
+
+	for _, fd := range fds {
+		if fd.IsDir() || !strings.EqualFold(
+			filepath.Ext(fd.Name()), ".json") {
+			continue
+		}
+
+		file := filepath.Join(configDir, fd.Name())
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		if !json.Valid(data) {
+			return fmt.Errorf("%s is not a valid json", fd.Name())
+		}
+	}
+
+	if !o.isClient() {
+		config := filepath.Join(o.Path, path.RoleConfig(o.Role))
+		if _, err := os.Stat(config); err != nil {
+			return err
+		}
+	}
+
+	if err := o.checkAdapterConfig(); err != nil {
+		return fmt.Errorf("invalid adapter config: %v", err)
+	}
+	return nil
+}
+
+// HealthCheck waits for the services to run and the ports to listen.
+func (o *OpenVPN) HealthCheck(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := o.healthy()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func (o *OpenVPN) healthy() error {
+	for _, s := range o.Status().Services {
+		if !strings.Contains(strings.ToLower(s.Status), "running") {
+			return fmt.Errorf("service %s is not running: %s",
+				s.Name, s.Status)
+		}
+	}
+
+	for _, p := range o.ports() {
+		if !p.Listening && p.Name != managementPort {
+			return fmt.Errorf("%s port %s %s is not listening",
+				p.Name, p.Proto, p.Addr)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package openvpn
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+
+	"github.com/privatix/dapp-openvpn/inst/openvpn/path"
+)
+
+// defaultVersion is used when the installed OpenVPN version can not be
+// determined. Configuration rendered for 2.4 is understood by 2.5 and 2.6.
+var defaultVersion = version{Major: 2, Minor: 4}
+
+var versionRegexp = regexp.MustCompile(`OpenVPN (\d+)\.(\d+)(?:\.(\d+))?`)
+
+type version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+func (v version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast checks that the version is not older than a given one.
+func (v version) AtLeast(major, minor int) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+	return v.Minor >= minor
+}
+
+func parseVersion(s string) (version, error) {
+	m := versionRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return version{}, fmt.Errorf("unknown openvpn version: %s", s)
+	}
+
+	var v version
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	v.Patch, _ = strconv.Atoi(m[3])
+	return v, nil
+}
+
+func (o *OpenVPN) openvpnBinary() string {
+	bin := filepath.Join(o.Path, path.Config.OpenVPN)
+	if runtime.GOOS == "linux" {
+		if _, err := os.Stat(bin); err != nil {
+			bin = "/usr/sbin/openvpn"
+		}
+	}
+	return bin
+}
+
+// detectVersion finds out a version of the OpenVPN binary. OpenVPN exits
+// with a non-zero code after printing its version, so the exit code is
+// ignored.
+func (o *OpenVPN) detectVersion() version {
+	out, _ := exec.Command(o.openvpnBinary(), "--version").Output()
+
+	v, err := parseVersion(string(out))
+	if err != nil {
+		return defaultVersion
+	}
+	return v
+}
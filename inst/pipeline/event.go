@@ -0,0 +1,148 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/privatix/dappctrl/util/log"
+)
+
+// Types of events.
+const (
+	EventStarted        = "started"
+	EventFinished       = "finished"
+	EventFailed         = "failed"
+	EventSkipped        = "skipped"
+	EventRolledBack     = "rolled-back"
+	EventRollbackFailed = "rollback-failed"
+)
+
+// Event is a progress event of a flow operation.
+type Event struct {
+	Type  string    `json:"type"`
+	Step  string    `json:"step"`
+	Index int       `json:"index"`
+	Total int       `json:"total"`
+	Time  time.Time `json:"time"`
+	// Duration of the operation in milliseconds.
+	Duration int64  `json:"duration,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Sink interface receives progress events of a flow.
+type Sink interface {
+	Event(*Event)
+}
+
+// SinkFunc is an adapter to use a function as a Sink.
+type SinkFunc func(*Event)
+
+// Event calls f(e).
+func (f SinkFunc) Event(e *Event) {
+	f(e)
+}
+
+// Hook is an action executed before or after a flow operation.
+// An error fails the operation.
+type Hook func(step string, in interface{}) error
+
+// Option is an option of a flow execution.
+type Option func(*options)
+
+type options struct {
+	sinks  []Sink
+	before []Hook
+	after  []Hook
+}
+
+// WithSink adds a sink of progress events.
+func WithSink(s Sink) Option {
+	return func(o *options) {
+		o.sinks = append(o.sinks, s)
+	}
+}
+
+// Before adds a hook executed before every operation.
+func Before(h Hook) Option {
+	return func(o *options) {
+		o.before = append(o.before, h)
+	}
+}
+
+// After adds a hook executed after every successful operation.
+func After(h Hook) Option {
+	return func(o *options) {
+		o.after = append(o.after, h)
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func (o *options) emit(e *Event) {
+	for _, s := range o.sinks {
+		s.Event(e)
+	}
+}
+
+// newEvent creates an event of the operation, started at the time.
+func newEvent(typ, step string, index, total int, started time.Time,
+	err error) *Event {
+	e := &Event{
+		Type:  typ,
+		Step:  step,
+		Index: index,
+		Total: total,
+		Time:  time.Now(),
+	}
+	if !started.IsZero() {
+		e.Duration = int64(e.Time.Sub(started) / time.Millisecond)
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// LogSink returns a sink, which logs progress events. Failures of
+// operations are logged by the flow along with the flow object.
+func LogSink(logger log.Logger) Sink {
+	return SinkFunc(func(e *Event) {
+		l := logger.Add("step", e.Step)
+		switch e.Type {
+		case EventFinished:
+			l = l.Add("duration", e.Duration)
+			l.Info(fmt.Sprintf("'%v' operation was successfully"+
+				" executed", e.Step))
+		case EventSkipped:
+			l.Info(fmt.Sprintf("'%v' operation was completed"+
+				" before, skipped", e.Step))
+		case EventRolledBack:
+			l.Info(fmt.Sprintf("'%v' operation was cancelled",
+				e.Step))
+		case EventRollbackFailed:
+			l.Add("error", e.Error).Warn(fmt.Sprintf(
+				"failed to cancel '%v' operation", e.Step))
+		}
+	})
+}
+
+// JSONSink returns a sink, which writes progress events to the writer
+// as JSON lines.
+func JSONSink(w io.Writer) Sink {
+	var mtx sync.Mutex
+	enc := json.NewEncoder(w)
+	return SinkFunc(func(e *Event) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		enc.Encode(e)
+	})
+}
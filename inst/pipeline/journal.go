@@ -0,0 +1,137 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/privatix/dappctrl/util"
+)
+
+// Journal has a record of the flow operations, which were completed.
+// It is saved after every operation, so that the flow interrupted by
+// a crash can be resumed or rolled back.
+type Journal struct {
+	Flow     string
+	Done     []string
+	State    json.RawMessage   `json:",omitempty"`
+	Failed   string            `json:",omitempty"`
+	Error    string            `json:",omitempty"`
+	Rollback map[string]string `json:",omitempty"`
+
+	file string
+}
+
+// Journaled interface is implemented by the flow objects,
+// which keep a journal of the flow operations.
+type Journaled interface {
+	Journal() *Journal
+}
+
+// NewJournal creates an empty journal of the flow stored in the file.
+func NewJournal(file, flow string) *Journal {
+	return &Journal{Flow: flow, file: file}
+}
+
+// ReadJournal reads the journal from the file.
+func ReadJournal(file string) (*Journal, error) {
+	j := &Journal{}
+	if err := util.ReadJSONFile(file, j); err != nil {
+		return nil, err
+	}
+	j.file = file
+	return j, nil
+}
+
+// IsDone returns true if the operation was completed.
+func (j *Journal) IsDone(name string) bool {
+	for _, v := range j.Done {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Restore restores the flow object state from the journal.
+func (j *Journal) Restore(in interface{}) error {
+	if len(j.State) == 0 {
+		return nil
+	}
+	return json.Unmarshal(j.State, in)
+}
+
+// Remove removes the journal file.
+func (j *Journal) Remove() error {
+	err := os.Remove(j.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (j *Journal) complete(name string, in interface{}) error {
+	if !j.IsDone(name) {
+		j.Done = append(j.Done, name)
+	}
+	return j.save(in)
+}
+
+func (j *Journal) fail(name string, err error, in interface{}) error {
+	j.Failed = name
+	j.Error = err.Error()
+	return j.save(in)
+}
+
+func (j *Journal) undo(name string, err error) error {
+	if err != nil {
+		if j.Rollback == nil {
+			j.Rollback = make(map[string]string)
+		}
+		j.Rollback[name] = err.Error()
+		return j.save(nil)
+	}
+
+	delete(j.Rollback, name)
+	if j.Failed == name {
+		j.Failed = ""
+		j.Error = ""
+	}
+	for i, v := range j.Done {
+		if v == name {
+			j.Done = append(j.Done[:i], j.Done[i+1:]...)
+			break
+		}
+	}
+	return j.save(nil)
+}
+
+// save writes the journal to a temporary file and renames it,
+// so that the journal is never left half-written.
+func (j *Journal) save(in interface{}) error {
+	if in != nil {
+		state, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		j.State = state
+	}
+
+	data, err := json.MarshalIndent(j, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	tmp := j.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.file)
+}
+
+func journalOf(in interface{}) *Journal {
+	if v, ok := in.(Journaled); ok {
+		return v.Journal()
+	}
+	return nil
+}
@@ -3,6 +3,8 @@ package pipeline
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/privatix/dappctrl/util/log"
 )
@@ -18,28 +20,139 @@ type Runner interface {
 // that can be applied in sequence.
 type Flow []Runner
 
-// Run executes the flow elements runner function.
-func (flow Flow) Run(in interface{}, logger log.Logger) error {
-	rollback := func(f Flow) {
-		for _, v := range f {
-			defer v.Cancel(in)
-		}
-	}
+// Run executes the flow elements runner function. If the flow object
+// keeps a journal, the operations recorded in it as completed are skipped
+// and every completed operation is recorded. On failure, the executed
+// operations are cancelled in reverse order. If the flow object returns
+// a plan, the operations are described in the plan instead. Progress
+// events are logged and sent to the sinks given in options.
+func (flow Flow) Run(in interface{}, logger log.Logger,
+	opts ...Option) error {
+	o := newOptions(append([]Option{WithSink(LogSink(logger))}, opts...))
 
-	var err error
 	for i, m := range flow {
-		err = m.Run(in)
+		if j := journalOf(in); j != nil && j.IsDone(m.Name()) {
+			o.emit(newEvent(EventSkipped, m.Name(), i, len(flow),
+				time.Time{}, nil))
+			continue
+		}
 
-		if err != nil {
+		if p := planOf(in); p != nil {
+			if err := p.add(m, in); err != nil {
+				return err
+			}
+			continue
+		}
+
+		started := time.Now()
+		o.emit(newEvent(EventStarted, m.Name(), i, len(flow),
+			time.Time{}, nil))
+
+		if err := o.run(m, in); err != nil {
 			object, _ := json.Marshal(in)
 			l := logger.Add("object", string(object))
 			l.Warn(fmt.Sprintf("failed to execute '%v' operation",
 				m.Name()))
-			rollback(flow[:i+1])
-			break
+			o.emit(newEvent(EventFailed, m.Name(), i, len(flow),
+				started, err))
+			if j := journalOf(in); j != nil {
+				jerr := j.fail(m.Name(), err, in)
+				if jerr != nil {
+					l.Add("error", jerr).Warn(
+						"failed to write journal")
+				}
+			}
+			rerr := flow[:i+1].rollback(in, logger, o, len(flow))
+			if rerr != nil {
+				return fmt.Errorf("%v, %v", err, rerr)
+			}
+			return err
+		}
+
+		if j := journalOf(in); j != nil && planOf(in) == nil {
+			if err := j.complete(m.Name(), in); err != nil {
+				return fmt.Errorf("failed to write journal: %v",
+					err)
+			}
+		}
+		o.emit(newEvent(EventFinished, m.Name(), i, len(flow),
+			started, nil))
+	}
+
+	if j := journalOf(in); j != nil && planOf(in) == nil {
+		return j.Remove()
+	}
+	return nil
+}
+
+// run executes the operation with its hooks.
+func (o *options) run(m Runner, in interface{}) error {
+	for _, h := range o.before {
+		if err := h(m.Name(), in); err != nil {
+			return fmt.Errorf("failed to execute hook: %v", err)
+		}
+	}
+
+	if err := m.Run(in); err != nil {
+		return err
+	}
+
+	for _, h := range o.after {
+		if err := h(m.Name(), in); err != nil {
+			return fmt.Errorf("failed to execute hook: %v", err)
+		}
+	}
+	return nil
+}
+
+// Rollback cancels the flow elements in reverse order. If the flow object
+// keeps a journal, only the operations recorded in it as completed or
+// failed are cancelled. It returns an error listing the operations,
+// which could not be cancelled.
+func (flow Flow) Rollback(in interface{}, logger log.Logger,
+	opts ...Option) error {
+	o := newOptions(append([]Option{WithSink(LogSink(logger))}, opts...))
+	return flow.rollback(in, logger, o, len(flow))
+}
+
+// rollback cancels the flow elements, total is a number of operations
+// in the whole flow.
+func (flow Flow) rollback(in interface{}, logger log.Logger,
+	o *options, total int) error {
+	var failed []string
+	for i := len(flow) - 1; i >= 0; i-- {
+		m := flow[i]
+		j := journalOf(in)
+		if j != nil && !j.IsDone(m.Name()) && j.Failed != m.Name() {
+			continue
+		}
+
+		started := time.Now()
+		err := m.Cancel(in)
+		if err != nil {
+			o.emit(newEvent(EventRollbackFailed, m.Name(), i,
+				total, started, err))
+			failed = append(failed, m.Name())
+		} else {
+			o.emit(newEvent(EventRolledBack, m.Name(), i,
+				total, started, nil))
+		}
+
+		if j == nil {
+			continue
+		}
+		if err := j.undo(m.Name(), err); err != nil {
+			logger.Add("error", err).Warn("failed to write journal")
 		}
-		logger.Info(fmt.Sprintf("'%v' operation was successfully executed",
-			m.Name()))
 	}
-	return err
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to roll back: %s",
+			strings.Join(failed, ", "))
+	}
+
+	if j := journalOf(in); j != nil {
+		return j.Remove()
+	}
+	return nil
 }
@@ -0,0 +1,190 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Kinds of changes.
+const (
+	KindFile    = "file"
+	KindService = "service"
+	KindCommand = "command"
+	KindDevice  = "device"
+)
+
+// Change is a description of a change, which an operation would make.
+type Change struct {
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+	Action string `json:"action"`
+	Diff   string `json:"diff,omitempty"`
+}
+
+// FileChange describes writing data to the file.
+func FileChange(file string, data []byte) Change {
+	c := Change{Kind: KindFile, Target: file}
+
+	old, err := ioutil.ReadFile(file)
+	if err != nil {
+		c.Action = "create"
+		c.Diff = Diff("", diffText(data))
+		return c
+	}
+
+	c.Action = "modify"
+	c.Diff = Diff(diffText(old), diffText(data))
+	if len(c.Diff) == 0 {
+		c.Action = "keep"
+	}
+	return c
+}
+
+// diffText returns the file content to compare. JSON is indented,
+// so that the changes are shown by lines.
+func diffText(data []byte) string {
+	var buf bytes.Buffer
+	if json.Valid(data) && json.Indent(&buf, data, "", "  ") == nil {
+		return buf.String()
+	}
+	return string(data)
+}
+
+// CommandChange describes executing the command.
+func CommandChange(name string, args ...string) Change {
+	return Change{
+		Kind:   KindCommand,
+		Target: strings.Join(append([]string{name}, args...), " "),
+		Action: "execute",
+	}
+}
+
+// ServiceChange describes the action on the service.
+func ServiceChange(action, name string) Change {
+	return Change{Kind: KindService, Target: name, Action: action}
+}
+
+// Step has the changes of a flow operation.
+type Step struct {
+	Operation string   `json:"operation"`
+	Changes   []Change `json:"changes"`
+}
+
+// Plan has the changes, which a flow would make.
+type Plan struct {
+	Steps []Step `json:"steps"`
+}
+
+// Planner interface is implemented by the runners, which can describe
+// the changes they would make without making them.
+type Planner interface {
+	Plan(interface{}) ([]Change, error)
+}
+
+// Planned interface is implemented by the flow objects, which are used to
+// plan a flow. If the object returns a plan, the flow operations are
+// described in the plan instead of being executed.
+type Planned interface {
+	Plan() *Plan
+}
+
+func (p *Plan) add(m Runner, in interface{}) error {
+	planner, ok := m.(Planner)
+	if !ok {
+		return fmt.Errorf("'%v' operation does not support dry run",
+			m.Name())
+	}
+
+	changes, err := planner.Plan(in)
+	if err != nil {
+		return fmt.Errorf("failed to plan '%v' operation: %v",
+			m.Name(), err)
+	}
+
+	if changes == nil {
+		changes = []Change{}
+	}
+	p.Steps = append(p.Steps, Step{Operation: m.Name(), Changes: changes})
+	return nil
+}
+
+// String returns the plan as a text.
+func (p *Plan) String() string {
+	var buf bytes.Buffer
+	for _, s := range p.Steps {
+		fmt.Fprintf(&buf, "%s:\n", s.Operation)
+		if len(s.Changes) == 0 {
+			fmt.Fprintf(&buf, "  no changes\n")
+		}
+		for _, c := range s.Changes {
+			fmt.Fprintf(&buf, "  %s %s %s\n",
+				c.Action, c.Kind, c.Target)
+			for _, line := range strings.SplitAfter(c.Diff, "\n") {
+				if len(line) != 0 {
+					fmt.Fprintf(&buf, "    %s", line)
+				}
+			}
+		}
+	}
+	return buf.String()
+}
+
+func planOf(in interface{}) *Plan {
+	if v, ok := in.(Planned); ok {
+		return v.Plan()
+	}
+	return nil
+}
+
+// Diff returns the lines removed from and added to a text, prefixed with
+// "-" and "+". It returns an empty string if the texts are equal.
+func Diff(a, b string) string {
+	x := splitLines(a)
+	y := splitLines(b)
+
+	// lcs[i][j] is a length of the longest common subsequence
+	// of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(&buf, "-%s\n", x[i])
+			i++
+		default:
+			fmt.Fprintf(&buf, "+%s\n", y[j])
+			j++
+		}
+	}
+	return buf.String()
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if len(s) == 0 {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/privatix/dappctrl/util"
 
 	"github.com/privatix/dapp-openvpn/adapter/config"
+	"github.com/privatix/dapp-openvpn/adapter/secret"
 )
 
 const (
@@ -31,6 +32,9 @@ const (
 
 	jsonIdent = "    "
 
+	// secretPerm is a mode of an adapter config keeping a password.
+	secretPerm = 0600
+
 	passwordLength = 12
 	saltLength     = 9 * 1e18
 )
@@ -107,6 +111,26 @@ func adjustment(product *data.Product, configFile string) error {
 	cfg.Sess.Product = product.ID
 	cfg.Sess.Password = pass
 
+	// The password is kept in the config only without a secret store.
+	if cfg.Secrets == nil {
+		err = util.WriteJSONFile(configFile, "", jsonIdent, &cfg)
+		if err != nil {
+			return err
+		}
+		return os.Chmod(configFile, secretPerm)
+	}
+
+	store, err := secret.New(cfg.Secrets, filepath.Dir(configFile))
+	if err != nil {
+		return err
+	}
+
+	name := "sess-" + product.ID
+	if err := store.Set(name, pass); err != nil {
+		return err
+	}
+	cfg.Sess.Password = secret.Ref(name)
+
 	return util.WriteJSONFile(configFile, "", jsonIdent, &cfg)
 }
 
@@ -26,11 +26,23 @@ then
 	    exit 1
     fi
 
+    # tunnel subnet in CIDR notation, /24 when a mask is omitted
+    case "$server" in
+        */*) ;;
+        *) server="$server/24" ;;
+    esac
+
     # defines default internet interface
     default=$(/sbin/route get default| grep interface| awk '{print $2}')
 
-    # defines openvpn interface
-    ip=${server%0}
+    # defines openvpn interface by the server tunnel address
+    if [ -n "$4" ]
+    then
+        ip="inet $4 "
+    else
+        ip=${server%/*}
+        ip=${ip%0}
+    fi
     for interface in $(/sbin/ifconfig | grep 'utun\|inet.*-->' | sed -E 's/[[:space:]:].*//;/^$/d')
     do
         var=$(/sbin/ifconfig "$interface" | sed 1d | grep inet | grep "$ip")
@@ -51,7 +63,7 @@ then
     # creates rules
     rm -f /usr/local/nat-rules
 
-    nats="nat on $default from $server/24 to any -> ($default)\nnat on $tun from $server/24 to any -> ($tun)"
+    nats="nat on $default from $server to any -> ($default)\nnat on $tun from $server to any -> ($tun)"
     echo "$nats" >> /usr/local/nat-rules
 
     ports="\npass in proto { tcp, udp } from any to any port $port"
@@ -59,7 +71,7 @@ then
 
     # Add , block from VPN to LAN
 
-    block_tolan="rfc1918 = \"{ 192.168.0.0/16, 172.16.0.0/12, 10.0.0.0/8 }\" \nvpnnet = \"{ $server/24 }\" \nblock in log quick from \$vpnnet to \$rfc1918"
+    block_tolan="rfc1918 = \"{ 192.168.0.0/16, 172.16.0.0/12, 10.0.0.0/8 }\" \nvpnnet = \"{ $server }\" \nblock in log quick from \$vpnnet to \$rfc1918"
     echo "${block_tolan}" >> /usr/local/nat-rules
 
     frwd=$(/usr/sbin/sysctl -n net.inet.ip.forwarding)
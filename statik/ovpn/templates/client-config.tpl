@@ -6,8 +6,12 @@ dev tun
 # with remote host
 proto {{if .Proto}}{{.Proto}}{{else}}tcp-client{{end}}
 
-# Encrypt packets with AES-256-CBC algorithm
-cipher {{if .Cipher}}{{.Cipher}}{{else}}AES-256-CBC{{end}}
+# Data channel ciphers to negotiate with
+# the server and a cipher to fall back to
+# when the server can not negotiate.
+{{if .AtLeast 2 5}}data-ciphers {{.Ciphers}}
+data-ciphers-fallback {{.Fallback}}{{else}}ncp-ciphers {{.Ciphers}}
+cipher {{.Fallback}}{{end}}
 
 # Enable TLS and assume client role
 # during TLS handshake.
@@ -56,25 +60,34 @@ ping-restart {{if .PingRestart}}{{.PingRestart}}{{else}}25{{end}}
 ping {{if .Ping}}{{.Ping}}{{else}}10{{end}}
 
 # Authenticate with server using
-# username/password in interactive mode
-auth-user-pass {{.AccessFile}}
-
+# username/password queried through
+# the management interface, so they
+# are never written to disk
+auth-user-pass
+auth-nocache
+
+# Accept only options related to
+# the agent's subnet and policy.
 pull
-pull-filter accept "route 10.217.3."
-pull-filter accept "ifconfig 10.217.3"
-pull-filter accept "route-gateway 10.217.3"
+pull-filter accept "route {{.Subnet}}"
+pull-filter accept "ifconfig {{.Subnet}}"
+pull-filter accept "route-gateway {{.Subnet}}"
 pull-filter accept "peer-id"
 pull-filter accept "topology"
-pull-filter accept "cipher AES-256-GCM"
+{{range .CipherList}}pull-filter accept "cipher {{.}}"
+{{end}}pull-filter accept "key-derivation"
+pull-filter accept "protocol-flags"
 pull-filter accept "ping"
-pull-filter accept "dhcp-option DNS 8.8.8.8"
-pull-filter accept "dhcp-option DNS 8.8.4.4"
-pull-filter accept "redirect-gateway def1"
-pull-filter ignore ""
-
-# Redirect all traffic to VPN 
-redirect-gateway def1
-
+{{if .RedirectGateway}}{{range .DNS}}pull-filter accept "dhcp-option DNS {{.}}"
+{{end}}pull-filter accept "redirect-gateway def1"
+{{end}}pull-filter ignore ""
+
+# Route policy: redirect all traffic to VPN
+# except excluded networks, or route only
+# included networks through VPN.
+{{if .RedirectGateway}}redirect-gateway def1
+{{end}}{{range .Routes}}route {{.Network}} {{.Mask}} {{.Gateway}}
+{{end}}
 remote-cert-tls server
 # take n as the number of seconds
 # to wait between connection retries
@@ -85,21 +98,30 @@ connect-retry {{if .ConnectRetry}}{{.ConnectRetry}}{{else}}5{{end}}
 <ca>
 {{.Ca}}</ca>
 
-# Enable compression on the VPN link.
-# Don't enable this unless it is also
-# enabled in the server config file.
-# Use fast LZO compression -- may add up
-# to 1 byte per packet for incompressible data.
-{{if .CompLZO}}{{.CompLZO}}{{else}};comp-lzo{{end}}
+# Control channel protection key.
+# Packets without a valid HMAC signature
+# (and, with tls-crypt, encryption)
+# are dropped before any TLS processing.
+{{if .TLSKey}}{{if eq .TLSKeyMode "tls-auth"}}key-direction 1
+{{end}}<{{.TLSKeyMode}}>
+{{.TLSKey}}</{{.TLSKeyMode}}>{{end}}
+
+# Compression is disabled, compressed and
+# encrypted traffic is vulnerable to VORACLE.
+# comp-lzo is only kept for agents which
+# still enable it on the server side.
+{{if .CompLZO}}{{.CompLZO}}
+{{end}}{{if .AtLeast 2 5}}allow-compression {{.Compression}}{{end}}
 
 # Set log file verbosity.
 verb 3
 {{if .LogAppend}}log-append {{.LogAppend}}{{end}}
 
 # Management interface settings
-management 0.0.0.0 {{if .ManagementPort}}{{.ManagementPort}}{{else}}7506{{end}}
+management 127.0.0.1 {{if .ManagementPort}}{{.ManagementPort}}{{else}}7506{{end}}
 management-hold
 management-signal
+management-query-passwords
 
 # Remap SIGUSR1 to SIGTERM to prevent holding in unconnected state
 remap-usr1 SIGTERM
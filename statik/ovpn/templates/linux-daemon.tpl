@@ -6,10 +6,10 @@ After=syslog.target
 After=postgresql.service
 
 [Service]
-Type=onshot
-ExecStart={{.Script}} on {{.Server}}
-ExecStop={{.Script}} off {{.Server}}
-Restart=on-failure
+Type=oneshot
+ExecStart={{.Installer}} nat on -workdir {{.Path}}
+ExecReload={{.Installer}} nat reload -workdir {{.Path}}
+ExecStop={{.Installer}} nat off -workdir {{.Path}}
 RemainAfterExit=yes
 User=root
 Group=root
@@ -15,8 +15,9 @@
     <array>
         <string>{{.Script}}</string>
 	<string>on</string>
-	<string>{{.Server}}</string>
+	<string>{{.Subnet}}</string>
 	<string>{{.Port}}</string>
+	<string>{{.ServerIP}}</string>
     </array>
     <key>RunAtLoad</key>
     <true/>
@@ -7,7 +7,10 @@ topology subnet
 ca "config/ca.crt"
 cert "config/server.crt"
 key "config/server.key"
-dh "config/dh2048.pem"
+dh none
+{{if .ECDHCurve}}ecdh-curve {{.ECDHCurve}}{{end}}
+{{if eq .TLSMode "tls-auth"}}tls-auth "config/ta.key" 0{{end}}
+{{if eq .TLSMode "tls-crypt"}}tls-crypt "config/ta.key"{{end}}
 management {{.Managment.IP}} {{.Managment.Port}}
 auth-user-pass-verify "bin/dappvpn{{if .IsWindows}}.exe{{end}} -config config/adapter.config.json" via-file
 verify-client-cert none
@@ -22,7 +25,10 @@ push "dhcp-option DNS 8.8.8.8"
 push "dhcp-option DNS 8.8.4.4"
 ifconfig-pool-persist "config/ipp.txt"
 keepalive 10 120
-comp-lzo
+{{if .AtLeast 2 5}}data-ciphers {{.Ciphers}}
+data-ciphers-fallback {{.DataCiphersFallback}}
+allow-compression {{.Compression}}{{else}}ncp-ciphers {{.Ciphers}}
+cipher {{.DataCiphersFallback}}{{end}}
 persist-key
 persist-tun
 {{if .IsWindows}}#{{end}}user {{.User}}